@@ -78,8 +78,29 @@ func (api *ServerAPI) PushVideoStream(path string, data []byte, timestamp uint32
 	return api.streamMgr.PushVideoFrame(path, data, timestamp, marker)
 }
 
-func (api *ServerAPI) AddStream(path string) {
-	api.streamMgr.AddStream(path)
+// PushTrackStream 推送某个轨道的 RTP 包，track 是 AddStream 时 media 的序号(0 为第一个)
+func (api *ServerAPI) PushTrackStream(path string, track int, data []byte, timestamp uint32, marker bool) error {
+	if !api.isRunning {
+		return fmt.Errorf("server is not running")
+	}
+
+	return api.streamMgr.PushTrackPacket(path, track, data, timestamp, marker)
+}
+
+// PushTrackFrame 推送某个轨道的一个编码单元(H.265/H.264 一帧 Annex B 数据，音频一帧)，按 AddStream 时声明的编码打包，
+// 比如 rtsp.NewPCMUMedia() 的轨道传 G.711 采样，rtsp.NewOpusMedia(2) 的轨道传一个 Opus 包
+func (api *ServerAPI) PushTrackFrame(path string, track int, unit []byte, timestamp uint32) error {
+	if !api.isRunning {
+		return fmt.Errorf("server is not running")
+	}
+
+	return api.streamMgr.PushTrackFrame(path, track, unit, timestamp)
+}
+
+// AddStream 添加流，media 按顺序声明轨道的编码(rtsp.NewH264Media()、rtsp.NewAACMedia()、
+// rtsp.NewPCMUMedia()/NewPCMAMedia()、rtsp.NewOpusMedia() 等)，不传时为一个 H.265 轨道
+func (api *ServerAPI) AddStream(path string, media ...*rtsp.MediaDescription) {
+	api.streamMgr.AddStream(path, media...)
 }
 
 func (api *ServerAPI) RemoveStream(path string) {
@@ -93,6 +114,46 @@ func (api *ServerAPI) GetStreams() []StreamInfo {
 func (api *ServerAPI) GetStreamInfo(path string) (*StreamInfo, bool) {
 	return api.streamMgr.GetStreamInfo(path)
 }
+
+// SetStreamParameterSets 更新流的参数集，DESCRIBE 的 SDP 会带上 sprop-vps/sps/pps
+func (api *ServerAPI) SetStreamParameterSets(path string, vps, sps, pps []byte) {
+	api.rtspServer.SetParameterSets(path, vps, sps, pps)
+}
+
+// SetStreamAudioConfig 更新流中 AAC 轨道的 AudioSpecificConfig，DESCRIBE 的 SDP 会带上 config=
+func (api *ServerAPI) SetStreamAudioConfig(path string, config []byte) {
+	api.rtspServer.SetAudioConfig(path, config)
+}
+
+// SetStreamVideoAttributes 设置 SDP 中的帧率和分辨率，分辨率为 0 时从 SPS 解析
+func (api *ServerAPI) SetStreamVideoAttributes(path string, frameRate float64, width, height int) {
+	api.rtspServer.SetVideoAttributes(path, frameRate, width, height)
+}
+
+// GetClientStats 返回播放端通过 RTCP 报告的丢包、抖动和 RTT，path 为空时返回所有流
+func (api *ServerAPI) GetClientStats(path string) []rtsp.ClientStats {
+	return api.rtspServer.ClientStats(path)
+}
+
+// SetKeyframeRequestCallback 设置请求关键帧的回调(PLI/FIR、新客户端 PLAY、丢包过多)，每个流按配置限频
+func (api *ServerAPI) SetKeyframeRequestCallback(callback func(streamPath string, reason rtsp.KeyframeRequestReason)) {
+	api.rtspServer.SetKeyframeRequestHandler(callback)
+}
+
+// SetStreamFEC 设置流的 ULPFEC 保护，UDP 客户端每 groupSize 个 RTP 包额外收到一个 FEC 包，0 关闭
+func (api *ServerAPI) SetStreamFEC(path string, groupSize int) {
+	api.rtspServer.SetFEC(path, groupSize)
+}
+
+// SetStreamGOPCache 开关流的 GOP 缓存，新的播放端不用等下一个关键帧，maxBytes<=0 时使用默认 4MB
+func (api *ServerAPI) SetStreamGOPCache(path string, enabled bool, maxBytes int) {
+	api.rtspServer.SetGOPCache(path, enabled, maxBytes)
+}
+
+// SetParameterHandler 设置 GET_PARAMETER / SET_PARAMETER 的处理者
+func (api *ServerAPI) SetParameterHandler(handler rtsp.ParameterHandler) {
+	api.rtspServer.SetParameterHandler(handler)
+}
 func (api *ServerAPI) GetSessionCount(path string) int {
 	return api.streamMgr.server.GetSessionCount(path)
 }
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/tthhr/go_rtsp/net/rtp"
 	"github.com/tthhr/go_rtsp/net/rtsp"
 	"github.com/tthhr/go_rtsp/utils"
 )
@@ -15,20 +18,30 @@ type StreamInfo struct {
 	lastFrameAt time.Time
 }
 
+// trackPayloader 轨道的打包器，PushTrackFrame 时使用，序号是打包器的状态所以要加锁。
+// AddPath 会去掉 nil 的 media，track 是服务端的轨道序号；编码不支持时 payloader 为 nil
+type trackPayloader struct {
+	track     int
+	payloader rtp.Payloader
+	mu        sync.Mutex
+}
+
 type StreamManager struct {
-	server  *rtsp.RTSPServer
-	streams map[string]*StreamInfo
-	mu      sync.RWMutex
+	server     *rtsp.RTSPServer
+	streams    map[string]*StreamInfo
+	payloaders map[string][]*trackPayloader
+	mu         sync.RWMutex
 }
 
 func NewStreamManager(server *rtsp.RTSPServer) *StreamManager {
 	return &StreamManager{
-		server:  server,
-		streams: make(map[string]*StreamInfo),
+		server:     server,
+		streams:    make(map[string]*StreamInfo),
+		payloaders: make(map[string][]*trackPayloader),
 	}
 }
 
-func (m *StreamManager) AddStream(path string) {
+func (m *StreamManager) AddStream(path string, media ...*rtsp.MediaDescription) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -38,7 +51,8 @@ func (m *StreamManager) AddStream(path string) {
 			CreatedAt:   time.Now(),
 			lastFrameAt: time.Now(),
 		}
-		m.server.AddPath(path)
+		m.server.AddPath(path, media...)
+		m.payloaders[path] = m.newTrackPayloaders(path, media)
 		utils.Info("Stream added: %s", path)
 	}
 }
@@ -48,6 +62,7 @@ func (m *StreamManager) RemoveStream(path string) {
 	defer m.mu.Unlock()
 
 	delete(m.streams, path)
+	delete(m.payloaders, path)
 	m.server.RemovePath(path)
 	utils.Info("Stream remove: %s", path)
 }
@@ -66,6 +81,86 @@ func (m *StreamManager) PushVideoFrame(path string, data []byte, timestamp uint3
 	return err
 }
 
+// PushTrackPacket 推送多轨道流中某个轨道的 RTP 包，track 是 AddStream 时 media 的序号
+func (m *StreamManager) PushTrackPacket(path string, track int, data []byte, timestamp uint32, marker bool) error {
+	tp, err := m.trackPayloader(path, track)
+	if err != nil {
+		return err
+	}
+	return m.server.PushTrackPacket(path, tp.track, data, timestamp, marker)
+}
+
+func (m *StreamManager) trackPayloader(path string, track int) (*trackPayloader, error) {
+	m.mu.RLock()
+	tracks, exists := m.payloaders[path]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("target path not exist")
+	}
+	if track < 0 || track >= len(tracks) || tracks[track] == nil {
+		return nil, fmt.Errorf("no track %d in %s", track, path)
+	}
+	return tracks[track], nil
+}
+
+// PushTrackFrame 用轨道声明的编码打包一个编码单元再推送，Marker 位由打包器决定
+func (m *StreamManager) PushTrackFrame(path string, track int, unit []byte, timestamp uint32) error {
+	tp, err := m.trackPayloader(path, track)
+	if err != nil {
+		return err
+	}
+	if tp.payloader == nil {
+		return fmt.Errorf("no payloader for track %d of %s", track, path)
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, packet := range tp.payloader.Packetize(unit, timestamp) {
+		// G.711 等按 MTU 切开时后面的包时间戳不同，以包头为准
+		packetTimestamp := binary.BigEndian.Uint32(packet[4:8])
+		if err := m.server.PushTrackPacket(path, tp.track, packet, packetTimestamp, packet[1]&0x80 != 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTrackPayloaders 按 AddStream 声明的轨道创建打包器，下标和 media 的序号一致，nil 的 media 为 nil。
+// 每个轨道使用不同的 SSRC，视频打包器发现参数集变化时更新 SDP
+func (m *StreamManager) newTrackPayloaders(path string, media []*rtsp.MediaDescription) []*trackPayloader {
+	if len(media) == 0 {
+		media = []*rtsp.MediaDescription{rtsp.NewH265Media()}
+	}
+	tracks := make([]*trackPayloader, 0, len(media))
+	track := 0
+	for i, md := range media {
+		if md == nil {
+			tracks = append(tracks, nil)
+			continue
+		}
+		tp := &trackPayloader{track: track}
+		track++
+		tracks = append(tracks, tp)
+
+		payloader, err := md.NewPayloader()
+		if err != nil {
+			utils.Warn("Stream %s track %d: %s", path, i, err.Error())
+			continue
+		}
+		if p, ok := payloader.(interface{ SetSSRC(ssrc uint32) }); ok {
+			p.SetSSRC(rand.Uint32())
+		}
+		if p, ok := payloader.(*rtp.AccessUnitPacketizer); ok {
+			p.OnParameterSets(func(vps, sps, pps []byte) {
+				m.server.SetParameterSets(path, vps, sps, pps)
+			})
+		}
+		tp.payloader = payloader
+	}
+	return tracks
+}
+
 func (m *StreamManager) GetStreams() []StreamInfo {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
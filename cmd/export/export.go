@@ -3,10 +3,19 @@ package main
 /*
 #include <stdlib.h>
 #include <stdint.h>
+
+// reason: 0 PLI, 1 FIR, 2 新客户端 PLAY, 3 丢包过多
+typedef void (*KeyframeRequestCallback)(const char* path, int reason);
+
+static void callKeyframeRequestCallback(KeyframeRequestCallback fn, const char* path, int reason) {
+	fn(path, reason);
+}
 */
 import "C"
 
 import (
+	"bytes"
+	"math/rand"
 	"sync"
 	"time"
 	"unsafe"
@@ -17,13 +26,23 @@ import (
 	"github.com/tthhr/go_rtsp/utils"
 )
 
+// 和 C 侧约定的编码值
+const (
+	CodecH265 = 0
+	CodecH264 = 1
+	CodecJPEG = 2
+)
+
 type StreamContext struct {
-	Path       string
-	Packetizer *rtp.RTPPacketizer
-	CachedVPS  []byte
-	CachedSPS  []byte
-	CachedPPS  []byte
-	Mutex      sync.Mutex // 保护该流的内部状态
+	Path           string
+	Codec          int
+	Packetizer     *rtp.AccessUnitPacketizer // H.265/H.264，自己处理参数集和 Marker 位
+	JPEGPacketizer *rtp.RTPPacketizer        // MJPEG
+	// AAC 轨道，AddStreamWithAudio 添加的流才有
+	AudioPacketizer *rtp.RTPPacketizer
+	AudioConfig     []byte
+	AudioSampleRate int
+	Mutex           sync.Mutex // 保护该流的内部状态
 }
 
 var (
@@ -35,13 +54,14 @@ var (
 //export InitRTSPServer
 func InitRTSPServer(port int) {
 	config := rtsp.RTSPServerInitConfig{
-		Port:        port,                    //rtsp协议监听端口
-		UdpEnable:   true,                    //udp传输启用？
-		TcpEnable:   false,                   //tcp传输启用？网络环境较差建议启用
-		ProtocolLog: true,                    //rtsp协议交互过程是否打印
-		MaxClient:   2,                       //最大客户端数量
-		MaxAction:   rtsp.StrategyKickOldest, //客户端满了之后的动作
-		ServerName:  "THR's Server",          //rtsp协议中显示的服务端名
+		Port:           port,                    //rtsp协议监听端口
+		UdpEnable:      true,                    //udp传输启用？
+		TcpEnable:      false,                   //tcp传输启用？网络环境较差建议启用
+		ProtocolLog:    true,                    //rtsp协议交互过程是否打印
+		MaxClient:      2,                       //最大客户端数量
+		MaxAction:      rtsp.StrategyKickOldest, //客户端满了之后的动作
+		ServerName:     "THR's Server",          //rtsp协议中显示的服务端名
+		SessionTimeout: 60,                      //会话超时时间(秒)，超时没有活动的客户端会被回收
 	}
 	var err error
 	serverInstance, err = api.NewServerAPI(config)
@@ -60,6 +80,13 @@ func InitRTSPServer(port int) {
 
 //export AddStream
 func AddStream(path *C.uchar, length C.int) {
+	AddStreamWithCodec(path, length, CodecH265)
+}
+
+// AddStreamWithCodec 添加指定编码的流，codec: 0 H.265, 1 H.264, 2 MJPEG
+//
+//export AddStreamWithCodec
+func AddStreamWithCodec(path *C.uchar, length C.int, codec C.int) {
 	if serverInstance == nil {
 		utils.Error("!!rtsp not init!!")
 		return
@@ -67,6 +94,29 @@ func AddStream(path *C.uchar, length C.int) {
 
 	// 1. 转换 C 字符串到 Go 字符串
 	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), length)
+	addStream(goPath, int(codec), nil)
+}
+
+// AddStreamWithAudio 添加带 AAC 音频轨道的流，codec 同 AddStreamWithCodec，
+// sampleRate 是采样率(也是音频的 RTP 时钟频率)，channels 是声道数，音频用 PushAACFrame 推送
+//
+//export AddStreamWithAudio
+func AddStreamWithAudio(path *C.uchar, length C.int, codec C.int, sampleRate C.int, channels C.int) {
+	if serverInstance == nil {
+		utils.Error("!!rtsp not init!!")
+		return
+	}
+	if sampleRate <= 0 || channels <= 0 {
+		utils.Error("Invalid audio %d Hz %d channels", int(sampleRate), int(channels))
+		return
+	}
+
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), length)
+	addStream(goPath, int(codec), rtsp.NewAACMedia(int(sampleRate), int(channels), nil))
+}
+
+// addStream 添加流，audio 不为 nil 时作为第二个轨道
+func addStream(goPath string, codec int, audio *rtsp.MediaDescription) {
 	streamsMu.Lock()
 	defer streamsMu.Unlock()
 
@@ -75,15 +125,44 @@ func AddStream(path *C.uchar, length C.int) {
 		utils.Warn("Stream already exists: %s", goPath)
 		return
 	}
-	serverInstance.AddStream(goPath)
+	var video *rtsp.MediaDescription
+	switch codec {
+	case CodecH264:
+		video = rtsp.NewH264Media()
+	case CodecH265:
+		video = rtsp.NewH265Media()
+	case CodecJPEG:
+		video = rtsp.NewJPEGMedia()
+	default:
+		utils.Error("Unknown codec %d for stream %s", codec, goPath)
+		return
+	}
 
 	ctx := &StreamContext{
-		Path:       goPath,
-		Packetizer: rtp.NewRTPPacketizer(96, 90000),
-		// 缓存初始化为空切片
-		CachedVPS: nil,
-		CachedSPS: nil,
-		CachedPPS: nil,
+		Path:  goPath,
+		Codec: codec,
+	}
+	if codec == CodecJPEG {
+		ctx.JPEGPacketizer = rtp.NewRTPPacketizer(uint8(video.PayloadType), uint32(video.ClockRate))
+		ctx.JPEGPacketizer.SetSSRC(rand.Uint32())
+	} else {
+		ctx.Packetizer, _ = rtp.NewAccessUnitPacketizer(video.Encoding, uint8(video.PayloadType), uint32(video.ClockRate))
+		ctx.Packetizer.SetSSRC(rand.Uint32())
+		// 参数集变化时同步给 SDP
+		ctx.Packetizer.OnParameterSets(func(vps, sps, pps []byte) {
+			serverInstance.SetStreamParameterSets(goPath, vps, sps, pps)
+		})
+	}
+
+	if audio != nil {
+		serverInstance.AddStream(goPath, video, audio)
+		ctx.AudioPacketizer = rtp.NewRTPPacketizer(uint8(audio.PayloadType), uint32(audio.ClockRate))
+		// 每个轨道随机分配 SSRC，和 api.StreamManager 一致
+		ctx.AudioPacketizer.SetSSRC(rand.Uint32())
+		ctx.AudioConfig = audio.AudioConfig
+		ctx.AudioSampleRate = audio.ClockRate
+	} else {
+		serverInstance.AddStream(goPath, video)
 	}
 
 	streams[goPath] = ctx
@@ -107,6 +186,10 @@ func PushH265Frame(path *C.uchar, pathlen C.int, data *C.uchar, length C.int, ti
 		utils.Error("Stream path not found: %s", goPath)
 		return
 	}
+	if ctx.Codec != CodecH265 {
+		utils.Error("Stream %s is not H.265", goPath)
+		return
+	}
 
 	// 2. 转换数据
 	rawBytes := C.GoBytes(unsafe.Pointer(data), length)
@@ -114,114 +197,216 @@ func PushH265Frame(path *C.uchar, pathlen C.int, data *C.uchar, length C.int, ti
 		return
 	}
 
+	// 整帧一起打包，IRAP 前补参数集，小 NALU 聚合成 AP，最后一个包置 Marker 位
 	ctx.Mutex.Lock()
 	defer ctx.Mutex.Unlock()
-	nalus := splitNALUs(rawBytes)
+	ctx.sendPackets(ctx.Packetizer.PacketizeAccessUnit([][]byte{rawBytes}, uint32(timestamp)), uint32(timestamp))
+}
 
-	for i, nalu := range nalus {
-		isLast := (i == len(nalus)-1)
-		ctx.processAndSendNALU(nalu, uint32(timestamp), isLast, false)
+//export PushH264Frame
+func PushH264Frame(path *C.uchar, pathlen C.int, data *C.uchar, length C.int, timestamp C.uint32_t) {
+	if serverInstance == nil {
+		return
 	}
+
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), pathlen)
+
+	streamsMu.RLock()
+	ctx, exists := streams[goPath]
+	streamsMu.RUnlock()
+
+	if !exists {
+		utils.Error("Stream path not found: %s", goPath)
+		return
+	}
+	if ctx.Codec != CodecH264 {
+		utils.Error("Stream %s is not H.264", goPath)
+		return
+	}
+
+	rawBytes := C.GoBytes(unsafe.Pointer(data), length)
+	if len(rawBytes) == 0 {
+		return
+	}
+
+	// IDR 前补 SPS/PPS，小 NALU 聚合成 STAP-A
+	ctx.Mutex.Lock()
+	defer ctx.Mutex.Unlock()
+	ctx.sendPackets(ctx.Packetizer.PacketizeAccessUnit([][]byte{rawBytes}, uint32(timestamp)), uint32(timestamp))
 }
 
-func (ctx *StreamContext) processAndSendNALU(data []byte, ts uint32, isLastNALU bool, skipCompensation bool) {
-	if len(data) < 2 {
+// PushJPEGFrame 推送一帧 baseline JPEG(JFIF)，timestamp 和 H.265 一样是 90kHz
+//
+//export PushJPEGFrame
+func PushJPEGFrame(path *C.uchar, pathlen C.int, data *C.uchar, length C.int, timestamp C.uint32_t) {
+	if serverInstance == nil {
 		return
 	}
 
-	nalType := (data[0] >> 1) & 0x3F
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), pathlen)
+
+	streamsMu.RLock()
+	ctx, exists := streams[goPath]
+	streamsMu.RUnlock()
 
-	// 更新 Context 内部的缓存
-	switch nalType {
-	case 32: // VPS
-		ctx.CachedVPS = make([]byte, len(data))
-		copy(ctx.CachedVPS, data)
-	case 33: // SPS
-		ctx.CachedSPS = make([]byte, len(data))
-		copy(ctx.CachedSPS, data)
-	case 34: // PPS
-		ctx.CachedPPS = make([]byte, len(data))
-		copy(ctx.CachedPPS, data)
+	if !exists {
+		utils.Error("Stream path not found: %s", goPath)
+		return
+	}
+	if ctx.Codec != CodecJPEG {
+		utils.Error("Stream %s is not MJPEG", goPath)
+		return
 	}
 
-	if (nalType >= 19 && nalType <= 21) && !skipCompensation {
-		if len(ctx.CachedVPS) > 0 {
-			ctx.sendInternal(ctx.CachedVPS, ts, false)
+	rawBytes := C.GoBytes(unsafe.Pointer(data), length)
+	frame, err := rtp.ParseJPEG(rawBytes)
+	if err != nil {
+		utils.Warn("Stream %s: %s", goPath, err.Error())
+		return
+	}
+
+	ctx.Mutex.Lock()
+	defer ctx.Mutex.Unlock()
+	ctx.sendPackets(ctx.JPEGPacketizer.PacketizeJPEG(frame, uint32(timestamp)), uint32(timestamp))
+}
+
+// audioTrack AddStreamWithAudio 中音频是第二个轨道
+const audioTrack = 1
+
+// PushAACFrame 推送 AAC 音频，data 可以是一个或多个 ADTS 帧，也可以是一个不带头的 AU，
+// timestamp 以采样率为单位，多个 ADTS 帧时第一帧用它，后面每帧加 1024
+//
+//export PushAACFrame
+func PushAACFrame(path *C.uchar, pathlen C.int, data *C.uchar, length C.int, timestamp C.uint32_t) {
+	if serverInstance == nil {
+		return
+	}
+
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), pathlen)
+
+	streamsMu.RLock()
+	ctx, exists := streams[goPath]
+	streamsMu.RUnlock()
+
+	if !exists {
+		utils.Error("Stream path not found: %s", goPath)
+		return
+	}
+	if ctx.AudioPacketizer == nil {
+		utils.Error("Stream %s has no audio track", goPath)
+		return
+	}
+
+	rawBytes := C.GoBytes(unsafe.Pointer(data), length)
+	if len(rawBytes) == 0 {
+		return
+	}
+
+	ctx.Mutex.Lock()
+	defer ctx.Mutex.Unlock()
+
+	aus := [][]byte{rawBytes}
+	if rtp.IsADTS(rawBytes) {
+		header, frames, err := rtp.SplitADTS(rawBytes)
+		if err != nil {
+			utils.Warn("Stream %s: %s", goPath, err.Error())
 		}
-		if len(ctx.CachedSPS) > 0 {
-			ctx.sendInternal(ctx.CachedSPS, ts, false)
+		if len(frames) == 0 {
+			return
 		}
-		if len(ctx.CachedPPS) > 0 {
-			ctx.sendInternal(ctx.CachedPPS, ts, false)
+		// 编码参数以 ADTS 头为准，变化时同步给 SDP
+		if ctx.cacheParameterSet(&ctx.AudioConfig, header.AudioSpecificConfig()) {
+			if header.SampleRate != ctx.AudioSampleRate {
+				// SDP 的时钟频率和时间戳都按添加流时的采样率，不一致时播放端音画不同步
+				utils.Warn("Stream %s: ADTS sample rate %d, stream declared %d", goPath, header.SampleRate, ctx.AudioSampleRate)
+			}
+			serverInstance.SetStreamAudioConfig(ctx.Path, ctx.AudioConfig)
 		}
+		aus = frames
 	}
 
-	ctx.sendInternal(data, ts, isLastNALU)
+	for i, au := range aus {
+		ts := uint32(timestamp) + uint32(i*rtp.AACFrameSamples)
+		for _, pkt := range ctx.AudioPacketizer.PacketizeAAC(au, ts) {
+			serverInstance.PushTrackStream(ctx.Path, audioTrack, pkt, ts, pkt[1]&0x80 != 0)
+		}
+	}
 }
 
-func (ctx *StreamContext) sendInternal(data []byte, ts uint32, useMarker bool) {
-	// 使用 Context 自己的打包器
-	packets := ctx.Packetizer.PacketizeH265NALU(data, ts)
-
-	fullPath := ctx.Path
-
-	if !useMarker && len(packets) > 0 {
-		lastIdx := len(packets) - 1
-		packets[lastIdx][1] &= 0x7F
+// cacheParameterSet 缓存一份参数集，内容有变化时返回 true
+func (ctx *StreamContext) cacheParameterSet(cached *[]byte, data []byte) bool {
+	if bytes.Equal(*cached, data) {
+		return false
 	}
+	*cached = make([]byte, len(data))
+	copy(*cached, data)
+	return true
+}
 
-	for i, pkt := range packets {
-		isMarkerPacket := (i == len(packets)-1) && useMarker
+// sendPackets 推送一帧的包，Marker 位由打包器决定
+func (ctx *StreamContext) sendPackets(packets [][]byte, ts uint32) {
+	fullPath := ctx.Path
 
+	for _, pkt := range packets {
 		// 调用 ServerAPI 推流
-		serverInstance.PushVideoStream(fullPath, pkt, ts, isMarkerPacket)
+		serverInstance.PushVideoStream(fullPath, pkt, ts, pkt[1]&0x80 != 0)
 
 		// 简单的 Pacing
 		time.Sleep(1 * time.Microsecond)
 	}
 }
 
-func splitNALUs(data []byte) [][]byte {
-	var nalus [][]byte
-	if len(data) == 0 {
-		return nalus
+// SetStreamFrameRate 设置 SDP 中的 a=framerate，分辨率从 SPS 解析
+//
+//export SetStreamFrameRate
+func SetStreamFrameRate(path *C.uchar, pathlen C.int, fps C.double) {
+	if serverInstance == nil {
+		return
 	}
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), pathlen)
+	serverInstance.SetStreamVideoAttributes(goPath, float64(fps), 0, 0)
+}
 
-	start := 0
-	// 从第 1 个字节开始扫，寻找 00 00 01
-	for i := 0; i < len(data)-3; i++ {
-		// 优化：先判断 data[i] 是否为 0
-		if data[i] != 0 {
-			continue
-		}
-
-		// 命中 00 00 01
-		if data[i+1] == 0 && data[i+2] == 1 {
-			if i > start {
-				nalus = append(nalus, data[start:i])
-			}
-			start = i + 3
-			i += 2
-			continue
-		}
-
-		// 命中 00 00 00 01
-		if data[i+1] == 0 && data[i+2] == 0 && data[i+3] == 1 {
-			if i > start {
-				nalus = append(nalus, data[start:i])
-			}
-			start = i + 4
-			i += 3
-			continue
-		}
+// SetStreamGOPCache 开关 GOP 缓存，enable 非 0 开启，maxBytes<=0 时使用默认 4MB
+//
+//export SetStreamGOPCache
+func SetStreamGOPCache(path *C.uchar, pathlen C.int, enable C.int, maxBytes C.int) {
+	if serverInstance == nil {
+		return
 	}
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), pathlen)
+	serverInstance.SetStreamGOPCache(goPath, enable != 0, int(maxBytes))
+}
 
-	// 收尾
-	if start < len(data) {
-		nalus = append(nalus, data[start:])
+// SetStreamFEC 设置 UDP 客户端的 FEC 保护，每 groupSize 个 RTP 包(最多 48)额外发一个 FEC 包，0 关闭
+//
+//export SetStreamFEC
+func SetStreamFEC(path *C.uchar, pathlen C.int, groupSize C.int) {
+	if serverInstance == nil {
+		return
 	}
+	goPath := C.GoStringN((*C.char)(unsafe.Pointer(path)), pathlen)
+	serverInstance.SetStreamFEC(goPath, int(groupSize))
+}
 
-	return nalus
+// SetKeyframeRequestCallback 设置请求 IDR 的回调，传 NULL 取消。
+// 回调的 path 只在回调期间有效，编码器应尽快出一个 IDR，不要在回调里阻塞
+//
+//export SetKeyframeRequestCallback
+func SetKeyframeRequestCallback(fn C.KeyframeRequestCallback) {
+	if serverInstance == nil {
+		utils.Error("!!rtsp not init!!")
+		return
+	}
+	if fn == nil {
+		serverInstance.SetKeyframeRequestCallback(nil)
+		return
+	}
+	serverInstance.SetKeyframeRequestCallback(func(streamPath string, reason rtsp.KeyframeRequestReason) {
+		cPath := C.CString(streamPath)
+		defer C.free(unsafe.Pointer(cPath))
+		C.callKeyframeRequestCallback(fn, cPath, C.int(reason))
+	})
 }
 
 //export StopRTSPServer
@@ -21,13 +21,14 @@ func main() {
 	flag.Parse()
 	// Create server configuration
 	config := rtsp.RTSPServerInitConfig{
-		Port:        *rtspPort,               //rtsp协议监听端口
-		UdpEnable:   true,                    //udp传输启用？
-		TcpEnable:   false,                   //tcp传输启用？网络环境较差建议启用
-		ProtocolLog: true,                    //rtsp协议交互过程是否打印
-		MaxClient:   1,                       //最大客户端数量
-		MaxAction:   rtsp.StrategyKickOldest, //客户端满了之后的动作
-		ServerName:  "THR's Server",          //rtsp协议中显示的服务端名
+		Port:           *rtspPort,               //rtsp协议监听端口
+		UdpEnable:      true,                    //udp传输启用？
+		TcpEnable:      false,                   //tcp传输启用？网络环境较差建议启用
+		ProtocolLog:    true,                    //rtsp协议交互过程是否打印
+		MaxClient:      1,                       //最大客户端数量
+		MaxAction:      rtsp.StrategyKickOldest, //客户端满了之后的动作
+		ServerName:     "THR's Server",          //rtsp协议中显示的服务端名
+		SessionTimeout: 60,                      //会话超时时间(秒)，超时没有活动的客户端会被回收
 	}
 
 	// Create and start server
@@ -44,6 +45,8 @@ func main() {
 
 	if *filePath != "" {
 		server.AddStream("filetest")
+		server.SetStreamVideoAttributes("filetest", 25, 0, 0)
+		server.SetStreamGOPCache("filetest", true, 0)
 		go simulateVideoFileStream(server, "filetest", *filePath)
 	}
 	// Wait for interrupt signal
@@ -68,14 +71,18 @@ func simulateVideoFileStream(server *api.ServerAPI, path string, filepath string
 	defer reader.Stop()
 	reader.Start()
 
-	packetizer := rtp.NewRTPPacketizer(96, 90000)
+	// 参数集的缓存、IRAP 前补发和 Marker 位都由打包器处理
+	packetizer, _ := rtp.NewAccessUnitPacketizer("H265", 96, 90000)
+	packetizer.OnParameterSets(func(vps, sps, pps []byte) {
+		server.SetStreamParameterSets(path, vps, sps, pps)
+	})
 	frameInterval := time.Second / 25
 	timestampIncrement := uint32(90000 / 25)
 	var timestamp uint32
 
-	// --- 缓存参数集 ---
-	var vps, sps, pps []byte
-
+	// 文件里是连续的 NALU，凑齐一帧再发送
+	var frame [][]byte
+	hasVCL := false
 	for {
 		nalu, err := reader.ReadNextNALU()
 		if err != nil {
@@ -85,57 +92,39 @@ func simulateVideoFileStream(server *api.ServerAPI, path string, filepath string
 			}
 			continue
 		}
-
-		// --- 解析 NALU 类型 (H.265) ---
-		// NALU Header 是 2字节。Type 在第一个字节的 (bit 1-6)
-		// (nalu.Data[0] >> 1) & 0x3F
-
-		nalType := (nalu.Data[0] >> 1) & 0x3F
-		if len(vps) == 0 || len(sps) == 0 || len(pps) == 0 {
-			// 缓存关键参数
-			switch nalType {
-			case 32: // VPS
-				vps = make([]byte, len(nalu.Data))
-				copy(vps, nalu.Data)
-				utils.Debug("Got VPS")
-			case 33: // SPS
-				sps = make([]byte, len(nalu.Data))
-				copy(sps, nalu.Data)
-				utils.Debug("Got SPS")
-			case 34: // PPS
-				pps = make([]byte, len(nalu.Data))
-				copy(pps, nalu.Data)
-				utils.Debug("Got PPS")
-			}
+		if len(nalu.Data) < 3 {
+			continue
 		}
 
-		isKeyFrame := (nalType >= 19 && nalType <= 21)
-
-		if isKeyFrame {
-			// 按顺序发送参数集
-			if len(vps) > 0 {
-				sendNalu(server, packetizer, path, vps, timestamp)
-			}
-			if len(sps) > 0 {
-				sendNalu(server, packetizer, path, sps, timestamp)
-			}
-			if len(pps) > 0 {
-				sendNalu(server, packetizer, path, pps, timestamp)
-			}
+		if hasVCL && startsAccessUnit(nalu.Data) {
+			sendFrame(server, packetizer, path, frame, timestamp)
+			frame = nil
+			hasVCL = false
+			timestamp += timestampIncrement
+			time.Sleep(frameInterval)
 		}
+		frame = append(frame, nalu.Data)
+		if (nalu.Data[0]>>1)&0x3F < 32 {
+			hasVCL = true
+		}
+	}
+}
 
-		// 发送当前帧
-		sendNalu(server, packetizer, path, nalu.Data, timestamp)
-
-		timestamp += timestampIncrement
-		time.Sleep(frameInterval)
+// startsAccessUnit 已经有 slice 时，下一帧从参数集/AUD/前缀 SEI 或 first_slice_segment_in_pic_flag 为 1 的 slice 开始
+func startsAccessUnit(nalu []byte) bool {
+	nalType := (nalu[0] >> 1) & 0x3F
+	switch {
+	case nalType < 32:
+		return nalu[2]&0x80 != 0
+	case nalType >= 32 && nalType <= 35, nalType == 39:
+		return true
 	}
+	return false
 }
 
-func sendNalu(server *api.ServerAPI, packetizer *rtp.RTPPacketizer, path string, data []byte, timestamp uint32) {
-	packets := packetizer.PacketizeH265NALU(data, timestamp)
-	for i, pkt := range packets {
-		server.PushVideoStream(path, pkt, timestamp, i == len(packets)-1)
+func sendFrame(server *api.ServerAPI, packetizer *rtp.AccessUnitPacketizer, path string, frame [][]byte, timestamp uint32) {
+	for _, pkt := range packetizer.PacketizeAccessUnit(frame, timestamp) {
+		server.PushVideoStream(path, pkt, timestamp, pkt[1]&0x80 != 0)
 		// 稍微加一点点间隔防止UDP发太快爆缓冲区
 		time.Sleep(1 * time.Millisecond)
 	}
@@ -0,0 +1,146 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// AAC RTP 打包 (RFC 3640 mpeg4-generic, mode=AAC-hbr)
+// 负载: AU-headers-length(16 位，单位是位) + 每个 AU 一个 16 位 AU-header + AU 数据，
+// AU-header 是 AU-size(13) + AU-Index/AU-Index-delta(3)，和 SDP 的 sizelength/indexlength 对应
+const (
+	AACSizeLength  = 13
+	AACIndexLength = 3
+	// AACFrameSamples 一个 AAC-LC 帧的采样数，相邻 AU 的时间戳相差这么多
+	AACFrameSamples = 1024
+)
+
+// aacSampleRates ADTS/AudioSpecificConfig 的 samplingFrequencyIndex
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// ADTSHeader ADTS 头中我们关心的字段
+type ADTSHeader struct {
+	ObjectType   int // Audio Object Type，profile + 1，AAC-LC 为 2
+	SampleRate   int
+	Channels     int // channel_configuration
+	HeaderLength int // 7，带 CRC 时 9
+	FrameLength  int // 包括头
+}
+
+// IsADTS 判断数据是否以 ADTS 同步字 0xFFF 开头
+func IsADTS(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0xFF && data[1]&0xF0 == 0xF0
+}
+
+// ParseADTSHeader 解析一个 ADTS 头
+func ParseADTSHeader(data []byte) (ADTSHeader, error) {
+	var header ADTSHeader
+	if len(data) < 7 {
+		return header, fmt.Errorf("adts header too short: %d", len(data))
+	}
+	if !IsADTS(data) {
+		return header, fmt.Errorf("adts sync word not found")
+	}
+
+	header.HeaderLength = 7
+	if data[1]&0x01 == 0 { // protection_absent 为 0 时有 2 字节 CRC
+		header.HeaderLength = 9
+	}
+	header.ObjectType = int(data[2]>>6) + 1
+	index := int(data[2]>>2) & 0x0F
+	if index >= len(aacSampleRates) {
+		return header, fmt.Errorf("invalid adts sampling frequency index %d", index)
+	}
+	header.SampleRate = aacSampleRates[index]
+	header.Channels = int(data[2]&0x01)<<2 | int(data[3]>>6)
+	header.FrameLength = int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5)
+	if header.FrameLength < header.HeaderLength {
+		return header, fmt.Errorf("invalid adts frame length %d", header.FrameLength)
+	}
+	return header, nil
+}
+
+// SplitADTS 把连续的 ADTS 帧拆成去掉头的 AU，返回第一帧的头。
+// 最后一帧不完整时返回已经拆出的 AU 和错误
+func SplitADTS(data []byte) (ADTSHeader, [][]byte, error) {
+	var first ADTSHeader
+	var aus [][]byte
+	for len(data) > 0 {
+		header, err := ParseADTSHeader(data)
+		if err != nil {
+			return first, aus, err
+		}
+		if header.FrameLength > len(data) {
+			return first, aus, fmt.Errorf("adts frame truncated: %d > %d", header.FrameLength, len(data))
+		}
+		if len(aus) == 0 {
+			first = header
+		}
+		aus = append(aus, data[header.HeaderLength:header.FrameLength])
+		data = data[header.FrameLength:]
+	}
+	return first, aus, nil
+}
+
+// AudioSpecificConfig 生成 SDP config= 需要的 AudioSpecificConfig (ISO 14496-3 1.6.2.1)
+func (h ADTSHeader) AudioSpecificConfig() []byte {
+	return AudioSpecificConfig(h.ObjectType, h.SampleRate, h.Channels)
+}
+
+// AudioSpecificConfig objectType(5) + samplingFrequencyIndex(4) + channelConfiguration(4) + GASpecificConfig(3 个 0)，
+// 不在标准采样率表里时用 0xF 加 24 位采样率
+func AudioSpecificConfig(objectType, sampleRate, channels int) []byte {
+	index := 0x0F
+	for i, rate := range aacSampleRates {
+		if rate == sampleRate {
+			index = i
+			break
+		}
+	}
+	if index != 0x0F {
+		config := uint16(objectType&0x1F)<<11 | uint16(index)<<7 | uint16(channels&0x0F)<<3
+		return binary.BigEndian.AppendUint16(nil, config)
+	}
+
+	// 5 + 4 + 24 + 4 + 3 = 40 位
+	config := uint64(objectType&0x1F)<<35 | uint64(0x0F)<<31 | uint64(sampleRate&0xFFFFFF)<<7 | uint64(channels&0x0F)<<3
+	return binary.BigEndian.AppendUint64(nil, config)[3:]
+}
+
+// PacketizeAAC 将一个 AAC AU(不带 ADTS 头) 打包成 RTP 包。
+// 放得下时一个包一个 AU，否则按 RFC 3640 3.2.3 分片，每个分片都带完整 AU 的 AU-header，
+// 只有最后一个分片置 Marker 位
+func (p *RTPPacketizer) PacketizeAAC(au []byte, timestamp uint32) [][]byte {
+	var packets [][]byte
+	if len(au) == 0 || len(au) >= 1<<AACSizeLength {
+		return packets
+	}
+
+	// RTP头(12) + AU-headers-length(2) + AU-header(2)
+	maxPayload := p.mtuSize - 12 - 4
+	for offset := 0; offset < len(au); {
+		chunkSize := maxPayload
+		if offset+chunkSize > len(au) {
+			chunkSize = len(au) - offset
+		}
+
+		rtpHeader := make([]byte, 12)
+		rtpHeader[0] = 0x80
+		rtpHeader[1] = p.payloadType & 0x7F
+		if offset+chunkSize == len(au) {
+			rtpHeader[1] |= 0x80
+		}
+		binary.BigEndian.PutUint16(rtpHeader[2:4], p.sequenceNumber)
+		binary.BigEndian.PutUint32(rtpHeader[4:8], timestamp)
+		binary.BigEndian.PutUint32(rtpHeader[8:12], p.ssrc)
+
+		packet := binary.BigEndian.AppendUint16(rtpHeader, AACSizeLength+AACIndexLength)
+		packet = binary.BigEndian.AppendUint16(packet, uint16(len(au))<<AACIndexLength)
+		packet = append(packet, au[offset:offset+chunkSize]...)
+		packets = append(packets, packet)
+
+		offset += chunkSize
+		p.sequenceNumber++
+	}
+	return packets
+}
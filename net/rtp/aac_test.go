@@ -0,0 +1,224 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// adtsFrame 拼一个 ADTS 帧，crc 为 true 时带 2 字节 CRC
+func adtsFrame(objectType, rateIndex, channels int, crc bool, payload []byte) []byte {
+	headerLength := 7
+	if crc {
+		headerLength = 9
+	}
+	frameLength := headerLength + len(payload)
+
+	header := make([]byte, headerLength)
+	header[0] = 0xFF
+	header[1] = 0xF0
+	if !crc {
+		header[1] |= 0x01
+	}
+	header[2] = byte(objectType-1)<<6 | byte(rateIndex)<<2 | byte(channels>>2)
+	header[3] = byte(channels&0x03)<<6 | byte(frameLength>>11)
+	header[4] = byte(frameLength >> 3)
+	header[5] = byte(frameLength&0x07)<<5 | 0x1F
+	header[6] = 0xFC
+	return append(header, payload...)
+}
+
+func TestParseADTSHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    ADTSHeader
+		wantErr bool
+	}{
+		{
+			name: "aac lc 44100 stereo",
+			data: adtsFrame(2, 4, 2, false, make([]byte, 10)),
+			want: ADTSHeader{ObjectType: 2, SampleRate: 44100, Channels: 2, HeaderLength: 7, FrameLength: 17},
+		},
+		{
+			name: "with crc",
+			data: adtsFrame(2, 3, 1, true, make([]byte, 4)),
+			want: ADTSHeader{ObjectType: 2, SampleRate: 48000, Channels: 1, HeaderLength: 9, FrameLength: 13},
+		},
+		{
+			name: "eight channels",
+			data: adtsFrame(2, 11, 7, false, nil),
+			want: ADTSHeader{ObjectType: 2, SampleRate: 8000, Channels: 7, HeaderLength: 7, FrameLength: 7},
+		},
+		{
+			name:    "too short",
+			data:    adtsFrame(2, 4, 2, false, nil)[:6],
+			wantErr: true,
+		},
+		{
+			name:    "no sync word",
+			data:    []byte{0xFF, 0xE1, 0x50, 0x80, 0x02, 0x1F, 0xFC},
+			wantErr: true,
+		},
+		{
+			name:    "reserved sampling frequency index",
+			data:    adtsFrame(2, 13, 2, false, nil),
+			wantErr: true,
+		},
+		{
+			name:    "frame shorter than header",
+			data:    []byte{0xFF, 0xF1, 0x50, 0x80, 0x00, 0x1F, 0xFC},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseADTSHeader(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitADTS(t *testing.T) {
+	first := adtsFrame(2, 4, 2, false, []byte{1, 2, 3})
+	second := adtsFrame(2, 4, 2, true, []byte{4, 5})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    [][]byte
+		wantErr bool
+	}{
+		{
+			name: "two frames",
+			data: append(append([]byte{}, first...), second...),
+			want: [][]byte{{1, 2, 3}, {4, 5}},
+		},
+		{
+			name: "empty",
+			data: nil,
+			want: nil,
+		},
+		{
+			name:    "last frame truncated",
+			data:    append(append([]byte{}, first...), second[:len(second)-1]...),
+			want:    [][]byte{{1, 2, 3}},
+			wantErr: true,
+		},
+		{
+			name:    "garbage after frame",
+			data:    append(append([]byte{}, first...), 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06),
+			want:    [][]byte{{1, 2, 3}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, aus, err := SplitADTS(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(aus) != len(tt.want) {
+				t.Fatalf("got %d aus, want %d", len(aus), len(tt.want))
+			}
+			for i := range aus {
+				if !bytes.Equal(aus[i], tt.want[i]) {
+					t.Fatalf("au %d = %v, want %v", i, aus[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfig(t *testing.T) {
+	tests := []struct {
+		objectType, sampleRate, channels int
+		want                             []byte
+	}{
+		{2, 44100, 2, []byte{0x12, 0x10}},
+		{2, 48000, 2, []byte{0x11, 0x90}},
+		{2, 8000, 1, []byte{0x15, 0x88}},
+		// 不在表里的采样率: 0xF + 24 位采样率
+		{2, 50000, 1, []byte{0x17, 0x80, 0x61, 0xA8, 0x08}},
+	}
+	for _, tt := range tests {
+		if got := AudioSpecificConfig(tt.objectType, tt.sampleRate, tt.channels); !bytes.Equal(got, tt.want) {
+			t.Errorf("AudioSpecificConfig(%d, %d, %d) = %X, want %X", tt.objectType, tt.sampleRate, tt.channels, got, tt.want)
+		}
+	}
+}
+
+func TestPacketizeAAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		packets int
+	}{
+		{name: "single packet", size: 300, packets: 1},
+		{name: "exactly one packet", size: 1400 - 16, packets: 1},
+		{name: "fragmented", size: 3000, packets: 3},
+		{name: "largest au", size: 1<<AACSizeLength - 1, packets: 6},
+		{name: "empty", size: 0, packets: 0},
+		{name: "au size overflows header", size: 1 << AACSizeLength, packets: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewRTPPacketizer(97, 44100)
+			au := make([]byte, tt.size)
+			for i := range au {
+				au[i] = byte(i)
+			}
+
+			packets := p.PacketizeAAC(au, 1024)
+			if len(packets) != tt.packets {
+				t.Fatalf("got %d packets, want %d", len(packets), tt.packets)
+			}
+
+			var reassembled []byte
+			for i, packet := range packets {
+				if len(packet) > 1400 {
+					t.Errorf("packet %d is %d bytes, over mtu", i, len(packet))
+				}
+				if got := binary.BigEndian.Uint32(packet[4:8]); got != 1024 {
+					t.Errorf("packet %d timestamp = %d", i, got)
+				}
+				if got := binary.BigEndian.Uint16(packet[2:4]); got != uint16(i+1) {
+					t.Errorf("packet %d sequence = %d", i, got)
+				}
+				marker := packet[1]&0x80 != 0
+				if marker != (i == len(packets)-1) {
+					t.Errorf("packet %d marker = %v", i, marker)
+				}
+				// 每个分片都是 AU-headers-length=16 + 整个 AU 的大小
+				if got := binary.BigEndian.Uint16(packet[12:14]); got != 16 {
+					t.Errorf("packet %d AU-headers-length = %d", i, got)
+				}
+				header := binary.BigEndian.Uint16(packet[14:16])
+				if size := int(header >> AACIndexLength); size != tt.size {
+					t.Errorf("packet %d AU-size = %d, want %d", i, size, tt.size)
+				}
+				if index := header & 0x07; index != 0 {
+					t.Errorf("packet %d AU-Index = %d", i, index)
+				}
+				reassembled = append(reassembled, packet[16:]...)
+			}
+			if tt.packets > 0 && !bytes.Equal(reassembled, au) {
+				t.Fatal("reassembled au does not match")
+			}
+		})
+	}
+}
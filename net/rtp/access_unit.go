@@ -0,0 +1,200 @@
+package rtp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// AccessUnitPacketizer 按访问单元(一帧)打包 H.265/H.264：
+// 拆分 Annex B 起始码，缓存参数集并在这一帧没有带参数集的 IRAP/IDR 前补上，
+// 小 NALU 聚合成 AP/STAP-A，Marker 位只在整帧的最后一个包上
+type AccessUnitPacketizer struct {
+	packetizer *RTPPacketizer
+	h264       bool
+
+	vps, sps, pps   []byte
+	onParameterSets func(vps, sps, pps []byte)
+}
+
+// NewAccessUnitPacketizer 创建访问单元打包器，encoding 为 H265 或 H264
+func NewAccessUnitPacketizer(encoding string, payloadType uint8, clockRate uint32) (*AccessUnitPacketizer, error) {
+	p := &AccessUnitPacketizer{packetizer: NewRTPPacketizer(payloadType, clockRate)}
+	switch strings.ToUpper(encoding) {
+	case "H265":
+	case "H264":
+		p.h264 = true
+	default:
+		return nil, fmt.Errorf("access unit packetizer does not support %s", encoding)
+	}
+	return p, nil
+}
+
+// SetSSRC 修改 SSRC
+func (p *AccessUnitPacketizer) SetSSRC(ssrc uint32) {
+	p.packetizer.SetSSRC(ssrc)
+}
+
+// OnParameterSets 码流里的参数集变化时回调，用于更新 SDP 的 sprop-*，H.264 的 vps 为 nil
+func (p *AccessUnitPacketizer) OnParameterSets(handler func(vps, sps, pps []byte)) {
+	p.onParameterSets = handler
+}
+
+// ParameterSets 返回缓存的参数集
+func (p *AccessUnitPacketizer) ParameterSets() (vps, sps, pps []byte) {
+	return p.vps, p.sps, p.pps
+}
+
+// Packetize 实现 Payloader，unit 是一帧 Annex B 数据或一个不带起始码的 NALU
+func (p *AccessUnitPacketizer) Packetize(unit []byte, timestamp uint32) [][]byte {
+	return p.PacketizeAccessUnit([][]byte{unit}, timestamp)
+}
+
+// PacketizeAccessUnit 将一帧的所有 NALU 打包成 RTP 包。
+// nalus 的每一项可以是不带起始码的 NALU，也可以是带起始码的 Annex B 数据
+func (p *AccessUnitPacketizer) PacketizeAccessUnit(nalus [][]byte, timestamp uint32) [][]byte {
+	var frame [][]byte
+	changed := false
+	for _, unit := range nalus {
+		for _, nalu := range SplitAnnexB(unit) {
+			var ok bool
+			frame, ok = p.appendNALU(frame, nalu)
+			changed = changed || ok
+		}
+	}
+	if changed && p.onParameterSets != nil {
+		p.onParameterSets(p.vps, p.sps, p.pps)
+	}
+
+	var packets [][]byte
+	if p.h264 {
+		packets = p.packetizer.PacketizeH264STAPA(frame, timestamp)
+	} else {
+		packets = p.packetizer.PacketizeH265AP(frame, timestamp)
+	}
+	markFrameEnd(packets)
+	return packets
+}
+
+// appendNALU 缓存参数集，IRAP/IDR 之前这一帧还没有参数集时用缓存的补上，参数集变化时返回 true
+func (p *AccessUnitPacketizer) appendNALU(frame [][]byte, nalu []byte) ([][]byte, bool) {
+	if p.h264 {
+		if len(nalu) < 1 {
+			return frame, false
+		}
+		changed := false
+		switch nalu[0] & 0x1F {
+		case 7: // SPS
+			changed = cacheParameterSet(&p.sps, nalu)
+		case 8: // PPS
+			changed = cacheParameterSet(&p.pps, nalu)
+		case 5: // IDR
+			if !hasParameterSets(frame, h264ParameterSet) {
+				frame = appendParameterSets(frame, p.sps, p.pps)
+			}
+		}
+		return append(frame, nalu), changed
+	}
+
+	if len(nalu) < 2 {
+		return frame, false
+	}
+	changed := false
+	switch nalType := (nalu[0] >> 1) & 0x3F; {
+	case nalType == 32: // VPS
+		changed = cacheParameterSet(&p.vps, nalu)
+	case nalType == 33: // SPS
+		changed = cacheParameterSet(&p.sps, nalu)
+	case nalType == 34: // PPS
+		changed = cacheParameterSet(&p.pps, nalu)
+	case nalType >= 19 && nalType <= 21: // IRAP
+		if !hasParameterSets(frame, h265ParameterSet) {
+			frame = appendParameterSets(frame, p.vps, p.sps, p.pps)
+		}
+	}
+	return append(frame, nalu), changed
+}
+
+func h264ParameterSet(nalu []byte) bool {
+	nalType := nalu[0] & 0x1F
+	return nalType == 7 || nalType == 8
+}
+
+func h265ParameterSet(nalu []byte) bool {
+	nalType := (nalu[0] >> 1) & 0x3F
+	return nalType >= 32 && nalType <= 34
+}
+
+// hasParameterSets 这一帧里是否已经有参数集
+func hasParameterSets(frame [][]byte, isParameterSet func(nalu []byte) bool) bool {
+	for _, nalu := range frame {
+		if isParameterSet(nalu) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendParameterSets(frame [][]byte, sets ...[]byte) [][]byte {
+	for _, set := range sets {
+		if len(set) > 0 {
+			frame = append(frame, set)
+		}
+	}
+	return frame
+}
+
+// cacheParameterSet 缓存一份参数集，内容有变化时返回 true
+func cacheParameterSet(cached *[]byte, data []byte) bool {
+	if bytes.Equal(*cached, data) {
+		return false
+	}
+	*cached = append([]byte(nil), data...)
+	return true
+}
+
+// markFrameEnd 清掉各个包自带的 Marker 位，只在一帧的最后一个包上置位
+func markFrameEnd(packets [][]byte) {
+	for i, packet := range packets {
+		if i == len(packets)-1 {
+			packet[1] |= 0x80
+		} else {
+			packet[1] &= 0x7F
+		}
+	}
+}
+
+// SplitAnnexB 按 00 00 01 / 00 00 00 01 起始码拆分 NALU，没有起始码时整段作为一个 NALU
+func SplitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	if len(data) == 0 {
+		return nalus
+	}
+
+	start := 0
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 {
+			continue
+		}
+		codeLen := 0
+		if data[i+2] == 1 {
+			codeLen = 3
+		} else if i+3 < len(data) && data[i+2] == 0 && data[i+3] == 1 {
+			codeLen = 4
+		}
+		if codeLen == 0 {
+			continue
+		}
+		if i > start {
+			nalus = append(nalus, data[start:i])
+		}
+		start = i + codeLen
+		i += codeLen - 1
+	}
+
+	// 收尾
+	if start < len(data) {
+		nalus = append(nalus, data[start:])
+	}
+	return nalus
+}
@@ -0,0 +1,188 @@
+package rtp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func annexB(nalus ...[]byte) []byte {
+	var data []byte
+	for i, nalu := range nalus {
+		if i%2 == 0 {
+			data = append(data, 0, 0, 0, 1)
+		} else {
+			data = append(data, 0, 0, 1)
+		}
+		data = append(data, nalu...)
+	}
+	return data
+}
+
+func TestNewAccessUnitPacketizer(t *testing.T) {
+	tests := []struct {
+		encoding string
+		wantErr  bool
+	}{
+		{encoding: "H265"},
+		{encoding: "h264"},
+		{encoding: "MPEG4-GENERIC", wantErr: true},
+		{encoding: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := NewAccessUnitPacketizer(tt.encoding, 96, 90000); (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.encoding, err, tt.wantErr)
+		}
+	}
+}
+
+// 参数集缓存、IRAP 前补参数集和 OnParameterSets 回调，多帧按顺序送入同一个打包器
+func TestAccessUnitPacketizerParameterSets(t *testing.T) {
+	vps, sps, pps := h265NALU(32, 24), h265NALU(33, 40), h265NALU(34, 8)
+	newSPS := h265NALU(33, 42)
+	idr, cra, trail := h265NALU(19, 3000), h265NALU(21, 200), h265NALU(1, 300)
+
+	steps := []struct {
+		name     string
+		unit     []byte
+		want     [][]byte
+		callback [][]byte // 期望回调的 vps/sps/pps，nil 表示不回调
+	}{
+		{
+			name: "idr before any parameter set",
+			unit: annexB(idr),
+			want: [][]byte{idr},
+		},
+		{
+			name:     "parameter sets cached",
+			unit:     annexB(vps, sps, pps, idr),
+			want:     [][]byte{vps, sps, pps, idr},
+			callback: [][]byte{vps, sps, pps},
+		},
+		{
+			name: "cached sets inserted before idr",
+			unit: annexB(idr),
+			want: [][]byte{vps, sps, pps, idr},
+		},
+		{
+			name: "cached sets inserted before cra",
+			unit: annexB(cra),
+			want: [][]byte{vps, sps, pps, cra},
+		},
+		{
+			name: "non irap untouched",
+			unit: annexB(trail),
+			want: [][]byte{trail},
+		},
+		{
+			name: "same sets do not call back",
+			unit: annexB(vps, sps, pps, trail),
+			want: [][]byte{vps, sps, pps, trail},
+		},
+		{
+			name:     "changed sps",
+			unit:     annexB(newSPS, idr),
+			want:     [][]byte{newSPS, idr},
+			callback: [][]byte{vps, newSPS, pps},
+		},
+		{
+			name: "nalu without start code",
+			unit: idr,
+			want: [][]byte{vps, newSPS, pps, idr},
+		},
+		{
+			name: "short nalus dropped",
+			unit: annexB([]byte{0x02}, trail),
+			want: [][]byte{trail},
+		},
+		{
+			name: "empty",
+			unit: nil,
+		},
+	}
+
+	p, err := NewAccessUnitPacketizer("H265", 96, 90000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]byte
+	p.OnParameterSets(func(vps, sps, pps []byte) {
+		got = [][]byte{vps, sps, pps}
+	})
+
+	for _, step := range steps {
+		got = nil
+		packets := p.Packetize(step.unit, 3000)
+		if nalus := h265Depacketize(t, packets); !reflect.DeepEqual(nalus, step.want) {
+			t.Fatalf("%s: got %d nalus, want %d", step.name, len(nalus), len(step.want))
+		}
+		if !reflect.DeepEqual(got, step.callback) {
+			t.Fatalf("%s: callback = %v, want %v", step.name, got != nil, step.callback != nil)
+		}
+		for i, packet := range packets {
+			if marker := packet[1]&0x80 != 0; marker != (i == len(packets)-1) {
+				t.Fatalf("%s: packet %d marker = %v", step.name, i, marker)
+			}
+		}
+	}
+
+	if v, s, pp := p.ParameterSets(); !reflect.DeepEqual([][]byte{v, s, pp}, [][]byte{vps, newSPS, pps}) {
+		t.Fatal("cached parameter sets mismatch")
+	}
+}
+
+func TestSplitAnnexB(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{
+			name: "four byte start codes",
+			data: []byte{0, 0, 0, 1, 0x40, 0x01, 0, 0, 0, 1, 0x42, 0x01},
+			want: [][]byte{{0x40, 0x01}, {0x42, 0x01}},
+		},
+		{
+			name: "three byte start codes",
+			data: []byte{0, 0, 1, 0x40, 0x01, 0, 0, 1, 0x42, 0x01},
+			want: [][]byte{{0x40, 0x01}, {0x42, 0x01}},
+		},
+		{
+			name: "mixed start codes",
+			data: []byte{0, 0, 0, 1, 0x40, 0x01, 0, 0, 1, 0x42, 0x01, 0x00},
+			want: [][]byte{{0x40, 0x01}, {0x42, 0x01, 0x00}},
+		},
+		{
+			name: "no start code",
+			data: []byte{0x26, 0x01, 0xAF},
+			want: [][]byte{{0x26, 0x01, 0xAF}},
+		},
+		{
+			name: "zeros inside nalu",
+			data: []byte{0, 0, 1, 0x26, 0x01, 0, 0, 3, 0, 0, 2},
+			want: [][]byte{{0x26, 0x01, 0, 0, 3, 0, 0, 2}},
+		},
+		{
+			name: "consecutive start codes",
+			data: []byte{0, 0, 1, 0, 0, 0, 1, 0x40, 0x01},
+			want: [][]byte{{0x40, 0x01}},
+		},
+		{
+			name: "start code only",
+			data: []byte{0, 0, 0, 1},
+			want: nil,
+		},
+		{
+			name: "empty",
+			data: nil,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitAnnexB(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package rtp
+
+import (
+	"encoding/binary"
+)
+
+// G.711 (RFC 3551 4.5.14) 和 Opus (RFC 7587) RTP 打包
+
+// G.711 的静态负载类型，时钟频率固定 8000
+const (
+	PayloadTypePCMU = 0
+	PayloadTypePCMA = 8
+)
+
+// OpusClockRate Opus 的 RTP 时钟频率固定 48000，和实际采样率无关
+const OpusClockRate = 48000
+
+// PacketizeG711 将 G.711 采样(μ-law/A-law 每字节一个采样) 打包成 RTP 包，
+// 超过 MTU 时按采样切开，每个包的时间戳加上前面的采样数。Marker 位不置
+func (p *RTPPacketizer) PacketizeG711(samples []byte, timestamp uint32) [][]byte {
+	var packets [][]byte
+	maxPayload := p.mtuSize - 12
+	for offset := 0; offset < len(samples); offset += maxPayload {
+		end := offset + maxPayload
+		if end > len(samples) {
+			end = len(samples)
+		}
+		packets = append(packets, p.createAudioPacket(samples[offset:end], timestamp+uint32(offset), false))
+	}
+	return packets
+}
+
+// PacketizeOpus 一个 Opus 包放在一个 RTP 包里，RFC 7587 不允许分片，超过 MTU 也不切开。
+// Marker 位不置(不使用 DTX 时没有 talkspurt)
+func (p *RTPPacketizer) PacketizeOpus(packet []byte, timestamp uint32) [][]byte {
+	if len(packet) == 0 {
+		return nil
+	}
+	return [][]byte{p.createAudioPacket(packet, timestamp, false)}
+}
+
+func (p *RTPPacketizer) createAudioPacket(payload []byte, timestamp uint32, marker bool) []byte {
+	packet := make([]byte, 12, 12+len(payload))
+	packet[0] = 0x80
+	packet[1] = p.payloadType & 0x7F
+	if marker {
+		packet[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(packet[2:4], p.sequenceNumber)
+	binary.BigEndian.PutUint32(packet[4:8], timestamp)
+	binary.BigEndian.PutUint32(packet[8:12], p.ssrc)
+	p.sequenceNumber++
+
+	return append(packet, payload...)
+}
@@ -0,0 +1,107 @@
+package rtp
+
+import (
+	"encoding/binary"
+)
+
+// ULPFEC 单个 level 0 掩码最多保护的包数(L=1 时 48 位掩码)
+const MaxULPFECGroupSize = 48
+
+// ULPFECEncoder 按 RFC 5109 生成 ULPFEC 包，只用 level 0:
+// 每 groupSize 个连续的媒体包(遇到帧结束 marker 提前结束)异或出一个 FEC 包，组内丢一个包可以恢复。
+// FEC 包使用单独的负载类型、序号和 SSRC
+type ULPFECEncoder struct {
+	payloadType uint8
+	groupSize   int
+	ssrc        uint32
+	sequence    uint16
+	group       [][]byte
+}
+
+func NewULPFECEncoder(payloadType uint8, groupSize int, ssrc uint32) *ULPFECEncoder {
+	if groupSize <= 0 {
+		groupSize = 1
+	}
+	if groupSize > MaxULPFECGroupSize {
+		groupSize = MaxULPFECGroupSize
+	}
+	return &ULPFECEncoder{
+		payloadType: payloadType,
+		groupSize:   groupSize,
+		ssrc:        ssrc,
+	}
+}
+
+// Add 加入一个已经发出的媒体包(12 字节固定头，序号已经是最终的)，
+// 凑满一组或者遇到 marker 时返回 FEC 包，否则返回 nil。packet 之后不能再修改
+func (e *ULPFECEncoder) Add(packet []byte) []byte {
+	if len(packet) < 12 {
+		return nil
+	}
+	if len(e.group) > 0 {
+		last := binary.BigEndian.Uint16(e.group[len(e.group)-1][2:4])
+		if binary.BigEndian.Uint16(packet[2:4]) != last+1 {
+			// 序号不连续，掩码表示不了，丢掉这一组
+			e.group = e.group[:0]
+		}
+	}
+	e.group = append(e.group, packet)
+
+	if len(e.group) < e.groupSize && packet[1]&0x80 == 0 {
+		return nil
+	}
+	fec := e.build()
+	e.group = e.group[:0]
+	return fec
+}
+
+func (e *ULPFECEncoder) build() []byte {
+	first, last := e.group[0], e.group[len(e.group)-1]
+	maskLen := 2
+	if len(e.group) > 16 {
+		maskLen = 6
+	}
+	protectionLen := 0
+	for _, packet := range e.group {
+		if len(packet)-12 > protectionLen {
+			protectionLen = len(packet) - 12
+		}
+	}
+
+	// RTP 头(12) + FEC 头(10) + level 0 头(2 + 掩码) + level 0 负载
+	fec := make([]byte, 12+10+2+maskLen+protectionLen)
+	fec[0] = 0x80
+	fec[1] = e.payloadType & 0x7F
+	binary.BigEndian.PutUint16(fec[2:4], e.sequence)
+	copy(fec[4:8], last[4:8])
+	binary.BigEndian.PutUint32(fec[8:12], e.ssrc)
+	e.sequence++
+
+	header := fec[12:22]
+	level := fec[22 : 24+maskLen]
+	payload := fec[24+maskLen:]
+	var lengthRecovery uint16
+	for i, packet := range e.group {
+		header[0] ^= packet[0]
+		header[1] ^= packet[1]
+		for j := 4; j < 8; j++ {
+			header[j] ^= packet[j]
+		}
+		lengthRecovery ^= uint16(len(packet) - 12)
+		for j, b := range packet[12:] {
+			payload[j] ^= b
+		}
+		// 掩码最高位对应 SN base
+		level[2+i/8] |= 0x80 >> (i % 8)
+	}
+
+	// E=0，L 表示 48 位掩码，P/X/CC 来自异或结果；去掉版本号
+	header[0] &= 0x3F
+	if maskLen == 6 {
+		header[0] |= 0x40
+	}
+	copy(header[2:4], first[2:4])
+	binary.BigEndian.PutUint16(header[8:10], lengthRecovery)
+	binary.BigEndian.PutUint16(level[0:2], uint16(protectionLen))
+	return fec
+}
@@ -0,0 +1,209 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fecMediaPacket 一个媒体包，负载长度各不相同，用来检查长度恢复和补零
+func fecMediaPacket(seq uint16, timestamp uint32, size int, marker bool) []byte {
+	packet := make([]byte, 12+size)
+	packet[0] = 0x80
+	packet[1] = 96
+	if marker {
+		packet[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(packet[2:4], seq)
+	binary.BigEndian.PutUint32(packet[4:8], timestamp)
+	binary.BigEndian.PutUint32(packet[8:12], 0x11223344)
+	for i := 12; i < len(packet); i++ {
+		packet[i] = byte(int(seq)*7 + i)
+	}
+	return packet
+}
+
+// fecProtected 返回 FEC 包 level 0 掩码保护的序号
+func fecProtected(t *testing.T, fec []byte) []uint16 {
+	t.Helper()
+	maskLen := 2
+	if fec[12]&0x40 != 0 {
+		maskLen = 6
+	}
+	if len(fec) < 24+maskLen {
+		t.Fatalf("fec packet too short: %d", len(fec))
+	}
+	base := binary.BigEndian.Uint16(fec[14:16])
+	var seqs []uint16
+	for i, b := range fec[24 : 24+maskLen] {
+		for bit := 0; bit < 8; bit++ {
+			if b&(0x80>>bit) != 0 {
+				seqs = append(seqs, base+uint16(i*8+bit))
+			}
+		}
+	}
+	return seqs
+}
+
+// ulpfecRecover 按 RFC 5109 §10.2 用 FEC 包和收到的其他包恢复丢失的一个包，SSRC 是媒体流的
+func ulpfecRecover(t *testing.T, fec []byte, received [][]byte, lost uint16, ssrc uint32) []byte {
+	t.Helper()
+	maskLen := 2
+	if fec[12]&0x40 != 0 {
+		maskLen = 6
+	}
+	protectionLen := int(binary.BigEndian.Uint16(fec[22:24]))
+	bits := make([]byte, 8)
+	copy(bits[0:2], fec[12:14])
+	copy(bits[2:6], fec[16:20])
+	copy(bits[6:8], fec[20:22])
+	payload := append([]byte(nil), fec[24+maskLen:]...)
+	if len(payload) != protectionLen {
+		t.Fatalf("fec payload %d bytes, protection length %d", len(payload), protectionLen)
+	}
+
+	for _, packet := range received {
+		bits[0] ^= packet[0]
+		bits[1] ^= packet[1]
+		for j := 4; j < 8; j++ {
+			bits[j-2] ^= packet[j]
+		}
+		length := uint16(len(packet) - 12)
+		bits[6] ^= byte(length >> 8)
+		bits[7] ^= byte(length)
+		for j, b := range packet[12:] {
+			payload[j] ^= b
+		}
+	}
+
+	length := int(binary.BigEndian.Uint16(bits[6:8]))
+	if length > protectionLen {
+		t.Fatalf("recovered length %d over protection length %d", length, protectionLen)
+	}
+	packet := make([]byte, 12+length)
+	packet[0] = 0x80 | bits[0]&0x3F
+	packet[1] = bits[1]
+	binary.BigEndian.PutUint16(packet[2:4], lost)
+	copy(packet[4:8], bits[2:6])
+	binary.BigEndian.PutUint32(packet[8:12], ssrc)
+	copy(packet[12:], payload[:length])
+	return packet
+}
+
+// 一组里丢任意一个包都能从 FEC 包恢复出原包
+func TestULPFECRecover(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupSize int
+		sizes     []int  // 每个包的负载长度
+		markers   []bool // 为 nil 时只有最后一个包带 marker
+		protected int    // FEC 保护的包数
+		firstSeq  uint16 // 为 0 时从 1000 开始
+	}{
+		{name: "full group", groupSize: 4, sizes: []int{100, 37, 1200, 5}, markers: []bool{false, false, false, false}, protected: 4},
+		{name: "marker ends group early", groupSize: 8, sizes: []int{300, 300, 17}, protected: 3},
+		{name: "single packet group", groupSize: 1, sizes: []int{64}, markers: []bool{false}, protected: 1},
+		{name: "long mask", groupSize: 20, sizes: []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120, 130, 140, 150, 160, 170, 180, 190, 200}, protected: 20},
+		{name: "sequence wraps", groupSize: 3, sizes: []int{8, 9, 10}, markers: []bool{false, false, false}, protected: 3, firstSeq: 0xFFFE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := NewULPFECEncoder(127, tt.groupSize, 0xAABBCCDD)
+			firstSeq := tt.firstSeq
+			if firstSeq == 0 {
+				firstSeq = 1000
+			}
+
+			var packets [][]byte
+			var fec []byte
+			for i, size := range tt.sizes {
+				marker := i == len(tt.sizes)-1
+				if tt.markers != nil {
+					marker = tt.markers[i]
+				}
+				packet := fecMediaPacket(firstSeq+uint16(i), 3000*uint32(i/2), size, marker)
+				packets = append(packets, packet)
+				out := encoder.Add(packet)
+				if i < tt.protected-1 && out != nil {
+					t.Fatalf("fec after packet %d", i)
+				}
+				if i == tt.protected-1 {
+					fec = out
+				}
+			}
+			if fec == nil {
+				t.Fatal("no fec packet")
+			}
+
+			if fec[0] != 0x80 || fec[1] != 127 {
+				t.Fatalf("fec rtp header % X", fec[:2])
+			}
+			if got := binary.BigEndian.Uint32(fec[8:12]); got != 0xAABBCCDD {
+				t.Fatalf("fec ssrc = %X", got)
+			}
+			last := packets[tt.protected-1]
+			if !bytes.Equal(fec[4:8], last[4:8]) {
+				t.Fatal("fec timestamp is not the last protected packet's")
+			}
+			if long := fec[12]&0x40 != 0; long != (tt.protected > 16) {
+				t.Fatalf("L bit = %v", long)
+			}
+			seqs := fecProtected(t, fec)
+			if len(seqs) != tt.protected || seqs[0] != firstSeq {
+				t.Fatalf("protected %v", seqs)
+			}
+
+			for lost := 0; lost < tt.protected; lost++ {
+				var received [][]byte
+				for i, packet := range packets[:tt.protected] {
+					if i != lost {
+						received = append(received, packet)
+					}
+				}
+				if got := ulpfecRecover(t, fec, received, seqs[lost], 0x11223344); !bytes.Equal(got, packets[lost]) {
+					t.Fatalf("lost %d: recovered % X, want % X", lost, got[:16], packets[lost][:16])
+				}
+			}
+		})
+	}
+}
+
+// 序号不连续时丢掉当前组，从断点重新开始
+func TestULPFECSequenceGap(t *testing.T) {
+	encoder := NewULPFECEncoder(127, 3, 1)
+	for _, seq := range []uint16{10, 11, 13, 14} {
+		if fec := encoder.Add(fecMediaPacket(seq, 0, 10, false)); fec != nil {
+			t.Fatalf("fec after seq %d", seq)
+		}
+	}
+	fec := encoder.Add(fecMediaPacket(15, 0, 10, false))
+	if fec == nil {
+		t.Fatal("no fec after three consecutive packets")
+	}
+	if seqs := fecProtected(t, fec); len(seqs) != 3 || seqs[0] != 13 {
+		t.Fatalf("protected %v, want 13-15", seqs)
+	}
+	if got := binary.BigEndian.Uint16(fec[2:4]); got != 0 {
+		t.Fatalf("fec sequence = %d, want 0", got)
+	}
+
+	// FEC 包自己的序号连续
+	for _, seq := range []uint16{16, 17, 18} {
+		fec = encoder.Add(fecMediaPacket(seq, 0, 10, false))
+	}
+	if fec == nil || binary.BigEndian.Uint16(fec[2:4]) != 1 {
+		t.Fatal("second fec packet missing or out of sequence")
+	}
+	if encoder.Add([]byte{0x80, 96}) != nil {
+		t.Fatal("fec for a short packet")
+	}
+}
+
+func TestNewULPFECEncoderGroupSize(t *testing.T) {
+	for _, tt := range []struct{ size, want int }{{0, 1}, {-3, 1}, {5, 5}, {MaxULPFECGroupSize + 1, MaxULPFECGroupSize}} {
+		if got := NewULPFECEncoder(127, tt.size, 1).groupSize; got != tt.want {
+			t.Errorf("group size %d: got %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package rtp
+
+import (
+	"encoding/binary"
+)
+
+// H.264 RTP 打包 (RFC 6184, packetization-mode=1)
+// 和 H.265 共用 RTPPacketizer 的序号/SSRC/MTU
+
+// PacketizeH264NALU 将 H.264 NALU 打包成 RTP 包，放得下用单包，否则用 FU-A
+func (p *RTPPacketizer) PacketizeH264NALU(nalu []byte, timestamp uint32) [][]byte {
+	var packets [][]byte
+	if len(nalu) < 1 {
+		return packets
+	}
+
+	// 减去 RTP Header(12)
+	if len(nalu) <= p.mtuSize-12 {
+		// 单包模式，NALU 头就是负载头
+		packets = append(packets, p.createSinglePacket(nalu, timestamp))
+	} else {
+		packets = append(packets, p.createH264FUAPackets(nalu, timestamp)...)
+	}
+	return packets
+}
+
+// PacketizeH264STAPA 把同一时间戳的多个小 NALU(比如 SPS+PPS) 聚合成 STAP-A 包，
+// 单个放不进聚合包的 NALU 退回 PacketizeH264NALU
+func (p *RTPPacketizer) PacketizeH264STAPA(nalus [][]byte, timestamp uint32) [][]byte {
+	var packets [][]byte
+	// STAP-A 头(1) 之后每个 NALU 前有 2 字节长度
+	maxPayload := p.mtuSize - 12
+
+	var group [][]byte
+	groupSize := 1
+	flush := func() {
+		switch len(group) {
+		case 0:
+		case 1:
+			packets = append(packets, p.createSinglePacket(group[0], timestamp))
+		default:
+			packets = append(packets, p.createSTAPAPacket(group, timestamp))
+		}
+		group = nil
+		groupSize = 1
+	}
+
+	for _, nalu := range nalus {
+		if len(nalu) < 1 {
+			continue
+		}
+		if 1+2+len(nalu) > maxPayload {
+			flush()
+			packets = append(packets, p.PacketizeH264NALU(nalu, timestamp)...)
+			continue
+		}
+		if groupSize+2+len(nalu) > maxPayload {
+			flush()
+		}
+		group = append(group, nalu)
+		groupSize += 2 + len(nalu)
+	}
+	flush()
+	return packets
+}
+
+// STAP-A (type 24)，Marker 位和单包模式一样默认置 1
+func (p *RTPPacketizer) createSTAPAPacket(nalus [][]byte, timestamp uint32) []byte {
+	// STAP-A 头: F 取所有 NALU 的或，NRI 取最大值
+	var f, nri byte
+	for _, nalu := range nalus {
+		f |= nalu[0] & 0x80
+		if nalu[0]&0x60 > nri {
+			nri = nalu[0] & 0x60
+		}
+	}
+
+	payload := []byte{f | nri | 24}
+	for _, nalu := range nalus {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	return p.createSinglePacket(payload, timestamp)
+}
+
+// FU-A 分片 (type 28)，H.264 的分片头是 FU indicator + FU header 2 字节
+func (p *RTPPacketizer) createH264FUAPackets(nalu []byte, timestamp uint32) [][]byte {
+	var packets [][]byte
+
+	nalHeader := nalu[0]
+	naluPayload := nalu[1:]
+
+	// MTU - RTP头(12) - FU indicator(1) - FU header(1)
+	maxPayload := p.mtuSize - 12 - 2
+
+	offset := 0
+	payloadLen := len(naluPayload)
+
+	for offset < payloadLen {
+		chunkSize := maxPayload
+		if offset+chunkSize > payloadLen {
+			chunkSize = payloadLen - offset
+		}
+
+		rtpHeader := make([]byte, 12)
+		rtpHeader[0] = 0x80
+		rtpHeader[1] = p.payloadType & 0x7F
+		if offset+chunkSize == payloadLen {
+			rtpHeader[1] |= 0x80
+		}
+
+		binary.BigEndian.PutUint16(rtpHeader[2:4], p.sequenceNumber)
+		binary.BigEndian.PutUint32(rtpHeader[4:8], timestamp)
+		binary.BigEndian.PutUint32(rtpHeader[8:12], p.ssrc)
+
+		// FU indicator: F + NRI 来自原 NALU 头，Type = 28
+		fuIndicator := (nalHeader & 0xE0) | 28
+
+		// FU header: S(1) + E(1) + R(1) + Type(5)
+		fuHeader := nalHeader & 0x1F
+		if offset == 0 {
+			fuHeader |= 0x80
+		} else if offset+chunkSize == payloadLen {
+			fuHeader |= 0x40
+		}
+
+		packet := append(rtpHeader, fuIndicator, fuHeader)
+		packet = append(packet, naluPayload[offset:offset+chunkSize]...)
+
+		packets = append(packets, packet)
+
+		offset += chunkSize
+		p.sequenceNumber++
+	}
+
+	return packets
+}
+
+// IsH264KeyframeStart 判断 RTP 负载是否是一个关键帧的开始：
+// SPS/PPS/IDR 单包、以 SPS 或 IDR 开头的 STAP-A、IDR 的第一个 FU-A 分片
+func IsH264KeyframeStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	nalType := payload[0] & 0x1F
+	switch nalType {
+	case 5, 7, 8:
+		return true
+	case 24:
+		// STAP-A: 第一个 NALU 的头在 1+2 处
+		if len(payload) < 4 {
+			return false
+		}
+		first := payload[3] & 0x1F
+		return first == 5 || first == 7 || first == 8
+	case 28:
+		if len(payload) < 2 {
+			return false
+		}
+		return payload[1]&0x80 != 0 && payload[1]&0x1F == 5
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// JPEG RTP 打包 (RFC 2435)
+// 负载: JPEG 头(8) [+ Restart Marker 头(4)] [+ 第一个分片的量化表头(4) 和量化表] + 扫描数据，
+// 量化表都放在包里(Q=255)，接收端不需要按 Q 值推算
+
+// PayloadTypeJPEG JPEG 的静态负载类型，时钟频率 90000
+const PayloadTypeJPEG = 26
+
+// jpegInBandQ Q>=128 表示量化表在包里，255 表示每帧的表可能变化
+const jpegInBandQ = 255
+
+// JPEG 标记
+const (
+	jpegSOI  = 0xD8
+	jpegEOI  = 0xD9
+	jpegSOF0 = 0xC0
+	jpegDHT  = 0xC4
+	jpegDQT  = 0xDB
+	jpegDRI  = 0xDD
+	jpegSOS  = 0xDA
+)
+
+// JPEGFrame 从 JFIF 中取出的 RFC 2435 需要的内容
+type JPEGFrame struct {
+	Type            uint8 // 0: YUV 4:2:2, 1: YUV 4:2:0，有 restart marker 时再加 64
+	Width           int
+	Height          int
+	RestartInterval uint16   // DRI，0 表示没有 restart marker
+	QuantTables     [][]byte // 按表号排列，zigzag 顺序，和 DQT 里一样
+	QuantPrecision  uint8    // 第 i 位为 1 表示第 i 个表是 16 位精度
+	Data            []byte   // SOS 之后的熵编码数据，不含 EOI
+}
+
+// ParseJPEG 解析一帧 baseline JPEG(JFIF)，只支持 3 个分量、色度不下采样的 4:2:2/4:2:0
+func ParseJPEG(data []byte) (*JPEGFrame, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegSOI {
+		return nil, fmt.Errorf("jpeg soi not found")
+	}
+
+	frame := &JPEGFrame{}
+	tables := make(map[int][]byte)
+	precision := make(map[int]bool)
+	maxTable := -1
+	sof := false
+
+	offset := 2
+	for {
+		// 标记之前可以有若干 0xFF 填充
+		for offset < len(data) && data[offset] == 0xFF && offset+1 < len(data) && data[offset+1] == 0xFF {
+			offset++
+		}
+		if offset+4 > len(data) || data[offset] != 0xFF {
+			return nil, fmt.Errorf("jpeg marker not found at %d", offset)
+		}
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		if length < 2 || offset+2+length > len(data) {
+			return nil, fmt.Errorf("jpeg segment 0x%02X truncated", marker)
+		}
+		segment := data[offset+4 : offset+2+length]
+		offset += 2 + length
+
+		switch marker {
+		case jpegDQT:
+			for len(segment) > 0 {
+				pq, tq := int(segment[0]>>4), int(segment[0]&0x0F)
+				size := 64
+				if pq != 0 {
+					size = 128
+				}
+				if len(segment) < 1+size || tq > 3 {
+					return nil, fmt.Errorf("jpeg dqt invalid")
+				}
+				tables[tq] = segment[1 : 1+size]
+				precision[tq] = pq != 0
+				if tq > maxTable {
+					maxTable = tq
+				}
+				segment = segment[1+size:]
+			}
+
+		case jpegSOF0:
+			if len(segment) < 6 {
+				return nil, fmt.Errorf("jpeg sof truncated")
+			}
+			frame.Height = int(binary.BigEndian.Uint16(segment[1:3]))
+			frame.Width = int(binary.BigEndian.Uint16(segment[3:5]))
+			components := int(segment[5])
+			if components != 3 || len(segment) < 6+components*3 {
+				return nil, fmt.Errorf("jpeg with %d components not supported", components)
+			}
+			switch segment[7] { // Y 的采样因子
+			case 0x21:
+				frame.Type = 0
+			case 0x22:
+				frame.Type = 1
+			default:
+				return nil, fmt.Errorf("jpeg sampling 0x%02X not supported", segment[7])
+			}
+			if segment[10] != 0x11 || segment[13] != 0x11 {
+				return nil, fmt.Errorf("jpeg chroma sampling not supported")
+			}
+			sof = true
+
+		case 0xC1, 0xC2, 0xC3, 0xC5, 0xC6, 0xC7, 0xC9, 0xCA, 0xCB, 0xCD, 0xCE, 0xCF:
+			return nil, fmt.Errorf("jpeg sof 0x%02X not supported, baseline only", marker)
+
+		case jpegDRI:
+			if len(segment) < 2 {
+				return nil, fmt.Errorf("jpeg dri truncated")
+			}
+			frame.RestartInterval = binary.BigEndian.Uint16(segment[0:2])
+
+		case jpegSOS:
+			if !sof {
+				return nil, fmt.Errorf("jpeg sos before sof")
+			}
+			if frame.Width > 2040 || frame.Height > 2040 || frame.Width == 0 || frame.Height == 0 {
+				return nil, fmt.Errorf("jpeg size %dx%d not supported", frame.Width, frame.Height)
+			}
+			// RFC 2435 的量化表按表号连续排列
+			for i := 0; i <= maxTable; i++ {
+				table, ok := tables[i]
+				if !ok {
+					return nil, fmt.Errorf("jpeg quantization table %d missing", i)
+				}
+				frame.QuantTables = append(frame.QuantTables, table)
+				if precision[i] {
+					frame.QuantPrecision |= 1 << i
+				}
+			}
+			if len(frame.QuantTables) == 0 {
+				return nil, fmt.Errorf("jpeg quantization table missing")
+			}
+			if frame.RestartInterval > 0 {
+				frame.Type += 64
+			}
+			scan := data[offset:]
+			if len(scan) >= 2 && scan[len(scan)-2] == 0xFF && scan[len(scan)-1] == jpegEOI {
+				scan = scan[:len(scan)-2]
+			}
+			frame.Data = scan
+			return frame, nil
+
+		case jpegDHT:
+			// RFC 2435 使用标准哈夫曼表，接收端自己生成
+		}
+	}
+}
+
+// PacketizeJPEG 将一帧 JPEG 打包成 RTP 包，最后一个包置 Marker 位。
+// 量化表只放在第一个分片里
+func (p *RTPPacketizer) PacketizeJPEG(frame *JPEGFrame, timestamp uint32) [][]byte {
+	var packets [][]byte
+	if frame == nil || len(frame.Data) == 0 {
+		return packets
+	}
+
+	// 量化表头: MBZ(8) + Precision(8) + Length(16)
+	quantLen := 0
+	for _, table := range frame.QuantTables {
+		quantLen += len(table)
+	}
+	quantHeader := []byte{0, frame.QuantPrecision}
+	quantHeader = binary.BigEndian.AppendUint16(quantHeader, uint16(quantLen))
+	for _, table := range frame.QuantTables {
+		quantHeader = append(quantHeader, table...)
+	}
+
+	for offset := 0; offset < len(frame.Data); {
+		header := make([]byte, 12, p.mtuSize)
+		header[0] = 0x80
+		header[1] = p.payloadType & 0x7F
+		binary.BigEndian.PutUint16(header[2:4], p.sequenceNumber)
+		binary.BigEndian.PutUint32(header[4:8], timestamp)
+		binary.BigEndian.PutUint32(header[8:12], p.ssrc)
+
+		// JPEG 头: Type-specific(8) + Fragment Offset(24) + Type + Q + Width/8 + Height/8
+		packet := binary.BigEndian.AppendUint32(header, uint32(offset)&0xFFFFFF)
+		packet = append(packet, frame.Type, jpegInBandQ, byte((frame.Width+7)/8), byte((frame.Height+7)/8))
+		if frame.Type >= 64 {
+			// F=1 L=1 Restart Count=0x3FFF，分片不按 restart interval 对齐
+			packet = binary.BigEndian.AppendUint16(packet, frame.RestartInterval)
+			packet = binary.BigEndian.AppendUint16(packet, 0xFFFF)
+		}
+		if offset == 0 {
+			packet = append(packet, quantHeader...)
+		}
+
+		chunkSize := p.mtuSize - len(packet)
+		if chunkSize <= 0 {
+			return nil
+		}
+		if offset+chunkSize >= len(frame.Data) {
+			chunkSize = len(frame.Data) - offset
+			packet[1] |= 0x80
+		}
+		packet = append(packet, frame.Data[offset:offset+chunkSize]...)
+		packets = append(packets, packet)
+
+		offset += chunkSize
+		p.sequenceNumber++
+	}
+	return packets
+}
+
+// IsJPEGFrameStart 判断 RTP 负载是否是一帧 JPEG 的第一个分片
+func IsJPEGFrameStart(payload []byte) bool {
+	return len(payload) >= 8 && payload[1] == 0 && payload[2] == 0 && payload[3] == 0
+}
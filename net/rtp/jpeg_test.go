@@ -0,0 +1,333 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func jpegSegment(marker byte, body ...byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(body)+2))
+	return append(segment, body...)
+}
+
+// jpegDQTSegment 一个表号为 id 的量化表，内容填 fill
+func jpegDQTSegment(id, fill byte, wide bool) []byte {
+	size, pq := 64, byte(0)
+	if wide {
+		size, pq = 128, 1
+	}
+	return jpegSegment(jpegDQT, append([]byte{pq<<4 | id}, bytes.Repeat([]byte{fill}, size)...)...)
+}
+
+func jpegSOFSegment(marker byte, width, height int, components, ySampling, cSampling byte) []byte {
+	body := []byte{8}
+	body = binary.BigEndian.AppendUint16(body, uint16(height))
+	body = binary.BigEndian.AppendUint16(body, uint16(width))
+	body = append(body, components, 1, ySampling, 0, 2, cSampling, 1, 3, cSampling, 1)
+	return jpegSegment(marker, body...)
+}
+
+var jpegSOSSegment = jpegSegment(jpegSOS, 3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 63, 0)
+
+// jpegFile SOI + 各段 + 扫描数据 + EOI
+func jpegFile(scan []byte, segments ...[]byte) []byte {
+	data := []byte{0xFF, jpegSOI}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	data = append(data, scan...)
+	return append(data, 0xFF, jpegEOI)
+}
+
+func TestParseJPEG(t *testing.T) {
+	scan := []byte{0x12, 0xFF, 0x00, 0x34}
+	dqt0 := jpegDQTSegment(0, 1, false)
+	dqt1 := jpegDQTSegment(1, 2, false)
+	sof := jpegSOFSegment(jpegSOF0, 640, 480, 3, 0x21, 0x11)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *JPEGFrame
+		wantErr bool
+	}{
+		{
+			name: "yuv 4:2:2",
+			data: jpegFile(scan, dqt0, dqt1, sof, jpegSegment(jpegDHT, 0), jpegSOSSegment),
+			want: &JPEGFrame{
+				Type: 0, Width: 640, Height: 480,
+				QuantTables: [][]byte{bytes.Repeat([]byte{1}, 64), bytes.Repeat([]byte{2}, 64)},
+				Data:        scan,
+			},
+		},
+		{
+			name: "yuv 4:2:0 with restart interval",
+			data: jpegFile(scan, dqt0, jpegSegment(jpegDRI, 0, 8), jpegSOFSegment(jpegSOF0, 320, 240, 3, 0x22, 0x11), jpegSOSSegment),
+			want: &JPEGFrame{
+				Type: 65, Width: 320, Height: 240, RestartInterval: 8,
+				QuantTables: [][]byte{bytes.Repeat([]byte{1}, 64)},
+				Data:        scan,
+			},
+		},
+		{
+			name: "16 bit table and fill bytes",
+			data: jpegFile(scan, dqt0, []byte{0xFF}, jpegDQTSegment(1, 3, true), sof, jpegSOSSegment),
+			want: &JPEGFrame{
+				Type: 0, Width: 640, Height: 480,
+				QuantTables:    [][]byte{bytes.Repeat([]byte{1}, 64), bytes.Repeat([]byte{3}, 128)},
+				QuantPrecision: 0x02,
+				Data:           scan,
+			},
+		},
+		{
+			name:    "no soi",
+			data:    jpegFile(scan, dqt0, sof, jpegSOSSegment)[2:],
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			data:    []byte{0xFF, jpegSOI},
+			wantErr: true,
+		},
+		{
+			name:    "segment truncated",
+			data:    jpegFile(nil, dqt0, sof)[:len(dqt0)+10],
+			wantErr: true,
+		},
+		{
+			name:    "segment length below two",
+			data:    []byte{0xFF, jpegSOI, 0xFF, jpegDQT, 0x00, 0x01},
+			wantErr: true,
+		},
+		{
+			name:    "garbage instead of marker",
+			data:    append([]byte{0xFF, jpegSOI, 0x00, 0x00, 0x00, 0x00}, sof...),
+			wantErr: true,
+		},
+		{
+			name:    "dqt table id out of range",
+			data:    jpegFile(scan, jpegDQTSegment(4, 1, false), sof, jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "dqt table truncated",
+			data:    jpegFile(scan, jpegSegment(jpegDQT, append([]byte{0x00}, make([]byte, 63)...)...), sof, jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "sof truncated",
+			data:    jpegFile(scan, dqt0, jpegSegment(jpegSOF0, 8, 0, 16), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "grayscale",
+			data:    jpegFile(scan, dqt0, jpegSOFSegment(jpegSOF0, 640, 480, 1, 0x11, 0x11), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "yuv 4:4:4",
+			data:    jpegFile(scan, dqt0, jpegSOFSegment(jpegSOF0, 640, 480, 3, 0x11, 0x11), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "subsampled chroma",
+			data:    jpegFile(scan, dqt0, jpegSOFSegment(jpegSOF0, 640, 480, 3, 0x22, 0x21), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "progressive",
+			data:    jpegFile(scan, dqt0, jpegSOFSegment(0xC2, 640, 480, 3, 0x21, 0x11), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "sos before sof",
+			data:    jpegFile(scan, dqt0, jpegSOSSegment, sof),
+			wantErr: true,
+		},
+		{
+			name:    "dri truncated",
+			data:    jpegFile(scan, dqt0, jpegSegment(jpegDRI, 0), sof, jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "width over 2040",
+			data:    jpegFile(scan, dqt0, jpegSOFSegment(jpegSOF0, 2048, 480, 3, 0x21, 0x11), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "zero height",
+			data:    jpegFile(scan, dqt0, jpegSOFSegment(jpegSOF0, 640, 0, 3, 0x21, 0x11), jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "no quantization table",
+			data:    jpegFile(scan, sof, jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "quantization table gap",
+			data:    jpegFile(scan, dqt0, jpegDQTSegment(2, 1, false), sof, jpegSOSSegment),
+			wantErr: true,
+		},
+		{
+			name:    "no sos",
+			data:    jpegFile(nil, dqt0, sof),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJPEG(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacketizeJPEG(t *testing.T) {
+	tables := [][]byte{bytes.Repeat([]byte{1}, 64), bytes.Repeat([]byte{2}, 64)}
+
+	tests := []struct {
+		name    string
+		frame   *JPEGFrame
+		mtu     int
+		packets int
+	}{
+		{
+			name:    "single packet",
+			frame:   &JPEGFrame{Type: 1, Width: 642, Height: 480, QuantTables: tables, Data: make([]byte, 500)},
+			mtu:     1400,
+			packets: 1,
+		},
+		{
+			name:    "fragmented",
+			frame:   &JPEGFrame{Type: 0, Width: 640, Height: 480, QuantTables: tables, Data: make([]byte, 3000)},
+			mtu:     1400,
+			packets: 3,
+		},
+		{
+			name:    "restart marker",
+			frame:   &JPEGFrame{Type: 64, Width: 640, Height: 480, RestartInterval: 4, QuantTables: tables, Data: make([]byte, 1200)},
+			mtu:     600,
+			packets: 3,
+		},
+		{
+			name:  "no data",
+			frame: &JPEGFrame{Type: 0, Width: 640, Height: 480, QuantTables: tables},
+			mtu:   1400,
+		},
+		{
+			name:  "nil frame",
+			frame: nil,
+			mtu:   1400,
+		},
+		{
+			name:  "mtu smaller than headers",
+			frame: &JPEGFrame{Type: 0, Width: 640, Height: 480, QuantTables: tables, Data: make([]byte, 100)},
+			mtu:   100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewRTPPacketizer(PayloadTypeJPEG, 90000)
+			p.mtuSize = tt.mtu
+			if tt.frame != nil {
+				for i := range tt.frame.Data {
+					tt.frame.Data[i] = byte(i)
+				}
+			}
+
+			packets := p.PacketizeJPEG(tt.frame, 3000)
+			if len(packets) != tt.packets {
+				t.Fatalf("got %d packets, want %d", len(packets), tt.packets)
+			}
+
+			var reassembled []byte
+			for i, packet := range packets {
+				if len(packet) > tt.mtu {
+					t.Errorf("packet %d is %d bytes, over mtu", i, len(packet))
+				}
+				marker := packet[1]&0x80 != 0
+				if marker != (i == len(packets)-1) {
+					t.Errorf("packet %d marker = %v", i, marker)
+				}
+				if pt := packet[1] & 0x7F; pt != PayloadTypeJPEG {
+					t.Errorf("packet %d payload type = %d", i, pt)
+				}
+
+				payload := packet[12:]
+				if start := IsJPEGFrameStart(payload); start != (i == 0) {
+					t.Errorf("packet %d frame start = %v", i, start)
+				}
+				offset := int(binary.BigEndian.Uint32(payload[0:4]) & 0xFFFFFF)
+				if offset != len(reassembled) {
+					t.Errorf("packet %d fragment offset = %d, want %d", i, offset, len(reassembled))
+				}
+				if payload[4] != tt.frame.Type || payload[5] != jpegInBandQ ||
+					int(payload[6]) != (tt.frame.Width+7)/8 || int(payload[7]) != (tt.frame.Height+7)/8 {
+					t.Errorf("packet %d jpeg header = % X", i, payload[4:8])
+				}
+				payload = payload[8:]
+
+				if tt.frame.Type >= 64 {
+					if got := binary.BigEndian.Uint16(payload[0:2]); got != tt.frame.RestartInterval {
+						t.Errorf("packet %d restart interval = %d", i, got)
+					}
+					if got := binary.BigEndian.Uint16(payload[2:4]); got != 0xFFFF {
+						t.Errorf("packet %d restart F/L/count = %04X", i, got)
+					}
+					payload = payload[4:]
+				}
+
+				// 只有第一个分片带量化表
+				if i == 0 {
+					if got := int(binary.BigEndian.Uint16(payload[2:4])); got != 128 {
+						t.Fatalf("quantization table length = %d", got)
+					}
+					if !bytes.Equal(payload[4:132], append(append([]byte{}, tables[0]...), tables[1]...)) {
+						t.Error("quantization tables mismatch")
+					}
+					payload = payload[132:]
+				}
+				reassembled = append(reassembled, payload...)
+			}
+			if tt.packets > 0 && !bytes.Equal(reassembled, tt.frame.Data) {
+				t.Fatal("reassembled scan data does not match")
+			}
+		})
+	}
+}
+
+func TestIsJPEGFrameStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{name: "offset zero", payload: []byte{0, 0, 0, 0, 1, 255, 80, 60}, want: true},
+		{name: "type specific ignored", payload: []byte{7, 0, 0, 0, 1, 255, 80, 60}, want: true},
+		{name: "non zero offset", payload: []byte{0, 0, 5, 0x78, 1, 255, 80, 60}, want: false},
+		{name: "too short", payload: []byte{0, 0, 0, 0}, want: false},
+		{name: "empty", payload: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := IsJPEGFrameStart(tt.payload); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
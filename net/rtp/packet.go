@@ -0,0 +1,64 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// RTPHeader RTP 固定头中我们用到的字段
+type RTPHeader struct {
+	Marker         bool
+	PayloadType    uint8
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+}
+
+// ParseRTPPacket 解析 RTP 包，返回头和去掉 CSRC/扩展头/填充之后的负载
+func ParseRTPPacket(packet []byte) (RTPHeader, []byte, error) {
+	var header RTPHeader
+	if len(packet) < 12 {
+		return header, nil, fmt.Errorf("rtp packet too short: %d", len(packet))
+	}
+	if packet[0]>>6 != 2 {
+		return header, nil, fmt.Errorf("invalid rtp version %d", packet[0]>>6)
+	}
+
+	header.Marker = packet[1]&0x80 != 0
+	header.PayloadType = packet[1] & 0x7F
+	header.SequenceNumber = binary.BigEndian.Uint16(packet[2:4])
+	header.Timestamp = binary.BigEndian.Uint32(packet[4:8])
+	header.SSRC = binary.BigEndian.Uint32(packet[8:12])
+
+	offset := 12 + int(packet[0]&0x0F)*4
+	if packet[0]&0x10 != 0 {
+		// 扩展头: profile(2) + length(2) + length*4
+		if len(packet) < offset+4 {
+			return header, nil, fmt.Errorf("rtp extension truncated")
+		}
+		offset += 4 + int(binary.BigEndian.Uint16(packet[offset+2:offset+4]))*4
+	}
+	end := len(packet)
+	if packet[0]&0x20 != 0 && end > 0 {
+		end -= int(packet[end-1])
+	}
+	if offset > end {
+		return header, nil, fmt.Errorf("rtp packet truncated")
+	}
+	return header, packet[offset:end], nil
+}
+
+// BuildRTPPacket 生成只有 12 字节固定头的 RTP 包
+func BuildRTPPacket(header RTPHeader, payload []byte) []byte {
+	packet := make([]byte, 12+len(payload))
+	packet[0] = 0x80
+	packet[1] = header.PayloadType & 0x7F
+	if header.Marker {
+		packet[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(packet[2:4], header.SequenceNumber)
+	binary.BigEndian.PutUint32(packet[4:8], header.Timestamp)
+	binary.BigEndian.PutUint32(packet[8:12], header.SSRC)
+	copy(packet[12:], payload)
+	return packet
+}
@@ -0,0 +1,95 @@
+package rtp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Payloader 把一个编码单元打包成 RTP 包：H.265/H.264 是一帧 Annex B 数据(或一个 NALU)，MJPEG 是一帧 JPEG，
+// 音频是一帧(AAC AU、Opus 包、一段 G.711 采样)。
+// 返回的包已经带好序号、时间戳和 Marker 位
+type Payloader interface {
+	Packetize(unit []byte, timestamp uint32) [][]byte
+}
+
+// PayloaderFactory 按 SDP 中的负载类型和时钟频率创建 Payloader
+type PayloaderFactory func(payloadType uint8, clockRate uint32) Payloader
+
+var (
+	payloaders   = make(map[string]PayloaderFactory)
+	payloadersMu sync.RWMutex
+)
+
+func init() {
+	RegisterPayloader("H265", func(pt uint8, clockRate uint32) Payloader {
+		p, _ := NewAccessUnitPacketizer("H265", pt, clockRate)
+		return p
+	})
+	RegisterPayloader("H264", func(pt uint8, clockRate uint32) Payloader {
+		p, _ := NewAccessUnitPacketizer("H264", pt, clockRate)
+		return p
+	})
+	RegisterPayloader("MPEG4-GENERIC", func(pt uint8, clockRate uint32) Payloader {
+		return aacPayloader{NewRTPPacketizer(pt, clockRate)}
+	})
+	RegisterPayloader("PCMU", func(pt uint8, clockRate uint32) Payloader {
+		return g711Payloader{NewRTPPacketizer(pt, clockRate)}
+	})
+	RegisterPayloader("PCMA", func(pt uint8, clockRate uint32) Payloader {
+		return g711Payloader{NewRTPPacketizer(pt, clockRate)}
+	})
+	RegisterPayloader("OPUS", func(pt uint8, clockRate uint32) Payloader {
+		return opusPayloader{NewRTPPacketizer(pt, clockRate)}
+	})
+	RegisterPayloader("JPEG", func(pt uint8, clockRate uint32) Payloader {
+		return jpegPayloader{NewRTPPacketizer(pt, clockRate)}
+	})
+}
+
+// RegisterPayloader 注册编码(SDP rtpmap 中的名字，不区分大小写)的 Payloader，已有的会被替换
+func RegisterPayloader(encoding string, factory PayloaderFactory) {
+	payloadersMu.Lock()
+	defer payloadersMu.Unlock()
+	payloaders[strings.ToUpper(encoding)] = factory
+}
+
+// NewPayloader 创建编码对应的 Payloader
+func NewPayloader(encoding string, payloadType uint8, clockRate uint32) (Payloader, error) {
+	payloadersMu.RLock()
+	factory, ok := payloaders[strings.ToUpper(encoding)]
+	payloadersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no payloader for encoding %s", encoding)
+	}
+	return factory(payloadType, clockRate), nil
+}
+
+type aacPayloader struct{ *RTPPacketizer }
+
+func (p aacPayloader) Packetize(au []byte, timestamp uint32) [][]byte {
+	return p.PacketizeAAC(au, timestamp)
+}
+
+type g711Payloader struct{ *RTPPacketizer }
+
+func (p g711Payloader) Packetize(samples []byte, timestamp uint32) [][]byte {
+	return p.PacketizeG711(samples, timestamp)
+}
+
+type opusPayloader struct{ *RTPPacketizer }
+
+func (p opusPayloader) Packetize(packet []byte, timestamp uint32) [][]byte {
+	return p.PacketizeOpus(packet, timestamp)
+}
+
+type jpegPayloader struct{ *RTPPacketizer }
+
+// Packetize 不是合法的 baseline JPEG 时返回 nil
+func (p jpegPayloader) Packetize(jpeg []byte, timestamp uint32) [][]byte {
+	frame, err := ParseJPEG(jpeg)
+	if err != nil {
+		return nil
+	}
+	return p.PacketizeJPEG(frame, timestamp)
+}
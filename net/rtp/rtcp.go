@@ -0,0 +1,262 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// RTCP 包类型 (RFC 3550)
+const (
+	RTCPTypeSR   = 200
+	RTCPTypeRR   = 201
+	RTCPTypeSDES = 202
+	RTCPTypeBYE  = 203
+	RTCPTypeAPP  = 204
+	// RFC 4585 反馈包
+	RTCPTypeRTPFB = 205
+	RTCPTypePSFB  = 206
+)
+
+// RTPFB/PSFB 的 FMT
+const (
+	RTPFBFormatNACK = 1
+
+	PSFBFormatPLI = 1
+	PSFBFormatFIR = 4 // RFC 5104
+)
+
+const sdesCNAME = 1
+
+// ntpEpochOffset 1900 到 1970 的秒数
+const ntpEpochOffset = 2208988800
+
+// SenderReport SR 中发送端的信息
+type SenderReport struct {
+	SSRC         uint32
+	NTPTime      time.Time // RTPTimestamp 对应的墙上时间
+	RTPTimestamp uint32
+	PacketCount  uint32
+	OctetCount   uint32 // 只算负载，不含 RTP 头
+}
+
+// NTPTimestamp 转换为 64 位 NTP 时间戳，高 32 位是秒，低 32 位是小数部分
+func NTPTimestamp(t time.Time) uint64 {
+	seconds := uint64(t.Unix()) + ntpEpochOffset
+	fraction := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// BuildSenderReport 生成 SR + SDES(CNAME) 的复合 RTCP 包，不带接收报告块
+func BuildSenderReport(sr SenderReport, cname string) []byte {
+	packet := make([]byte, 28)
+	packet[0] = 0x80 // V=2, P=0, RC=0
+	packet[1] = RTCPTypeSR
+	binary.BigEndian.PutUint16(packet[2:4], 6) // 长度以 32 位字为单位，减 1
+	binary.BigEndian.PutUint32(packet[4:8], sr.SSRC)
+	binary.BigEndian.PutUint64(packet[8:16], NTPTimestamp(sr.NTPTime))
+	binary.BigEndian.PutUint32(packet[16:20], sr.RTPTimestamp)
+	binary.BigEndian.PutUint32(packet[20:24], sr.PacketCount)
+	binary.BigEndian.PutUint32(packet[24:28], sr.OctetCount)
+
+	return append(packet, buildSDESCNAME(sr.SSRC, cname)...)
+}
+
+// buildSDESCNAME 只有一个 chunk、一个 CNAME 项的 SDES 包
+func buildSDESCNAME(ssrc uint32, cname string) []byte {
+	if len(cname) > 255 {
+		cname = cname[:255]
+	}
+	// SSRC(4) + type(1) + length(1) + cname + 结束的 0，补齐到 4 字节
+	chunkLen := 4 + 2 + len(cname) + 1
+	chunkLen = (chunkLen + 3) &^ 3
+
+	packet := make([]byte, 4+chunkLen)
+	packet[0] = 0x81 // V=2, SC=1
+	packet[1] = RTCPTypeSDES
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)/4-1))
+	binary.BigEndian.PutUint32(packet[4:8], ssrc)
+	packet[8] = sdesCNAME
+	packet[9] = byte(len(cname))
+	copy(packet[10:], cname)
+	return packet
+}
+
+// ReceptionReport RR/SR 中的一个接收报告块
+type ReceptionReport struct {
+	SSRC           uint32 // 被报告的发送端
+	FractionLost   uint8  // 上一个报告以来的丢包率，单位 1/256
+	CumulativeLost int32  // 累计丢包，24 位有符号数
+	HighestSeq     uint32 // 扩展的最高序号
+	Jitter         uint32 // 到达间隔抖动，RTP 时间戳单位
+	LSR            uint32 // 最近一个 SR 的 NTP 时间戳中间 32 位
+	DLSR           uint32 // 收到该 SR 到发出本报告的延时，单位 1/65536 秒
+}
+
+// RTCPPacket 复合 RTCP 包中解析出来的一个包，只填和类型相关的字段
+type RTCPPacket struct {
+	Type    uint8
+	SSRC    uint32            // SR/RR/APP 的发送者
+	Reports []ReceptionReport // SR/RR
+	CNAME   string            // SDES 第一个 chunk 的 CNAME
+	SSRCs   []uint32          // BYE 离开的源
+	Reason  string            // BYE
+	Subtype uint8             // APP 的 subtype，RTPFB/PSFB 的 FMT
+	Name    string            // APP
+	Data    []byte            // APP 的数据，RTPFB/PSFB 的 FCI
+
+	MediaSSRC uint32 // RTPFB/PSFB 反馈的媒体源
+}
+
+// ParseRTCP 解析复合 RTCP 包，不认识的类型跳过
+func ParseRTCP(data []byte) ([]RTCPPacket, error) {
+	var packets []RTCPPacket
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return packets, fmt.Errorf("rtcp header truncated")
+		}
+		if data[0]>>6 != 2 {
+			return packets, fmt.Errorf("invalid rtcp version %d", data[0]>>6)
+		}
+		length := (int(binary.BigEndian.Uint16(data[2:4])) + 1) * 4
+		if length > len(data) {
+			return packets, fmt.Errorf("rtcp packet truncated")
+		}
+		body := data[4:length]
+		if data[0]&0x20 != 0 && len(body) > 0 {
+			padding := int(body[len(body)-1])
+			if padding > len(body) {
+				return packets, fmt.Errorf("invalid rtcp padding")
+			}
+			body = body[:len(body)-padding]
+		}
+		count := int(data[0] & 0x1F)
+		packet := RTCPPacket{Type: data[1]}
+		data = data[length:]
+
+		var err error
+		switch packet.Type {
+		case RTCPTypeSR:
+			if len(body) < 24 {
+				return packets, fmt.Errorf("rtcp sr truncated")
+			}
+			packet.SSRC = binary.BigEndian.Uint32(body[0:4])
+			packet.Reports, err = parseReceptionReports(body[24:], count)
+		case RTCPTypeRR:
+			if len(body) < 4 {
+				return packets, fmt.Errorf("rtcp rr truncated")
+			}
+			packet.SSRC = binary.BigEndian.Uint32(body[0:4])
+			packet.Reports, err = parseReceptionReports(body[4:], count)
+		case RTCPTypeSDES:
+			packet.SSRC, packet.CNAME = parseSDESCNAME(body, count)
+		case RTCPTypeBYE:
+			if len(body) < count*4 {
+				return packets, fmt.Errorf("rtcp bye truncated")
+			}
+			for i := 0; i < count; i++ {
+				packet.SSRCs = append(packet.SSRCs, binary.BigEndian.Uint32(body[i*4:]))
+			}
+			if rest := body[count*4:]; len(rest) > 0 && int(rest[0]) < len(rest) {
+				packet.Reason = string(rest[1 : 1+int(rest[0])])
+			}
+		case RTCPTypeAPP:
+			if len(body) < 8 {
+				return packets, fmt.Errorf("rtcp app truncated")
+			}
+			packet.Subtype = uint8(count)
+			packet.SSRC = binary.BigEndian.Uint32(body[0:4])
+			packet.Name = string(body[4:8])
+			packet.Data = body[8:]
+		case RTCPTypeRTPFB, RTCPTypePSFB:
+			if len(body) < 8 {
+				return packets, fmt.Errorf("rtcp feedback truncated")
+			}
+			packet.Subtype = uint8(count)
+			packet.SSRC = binary.BigEndian.Uint32(body[0:4])
+			packet.MediaSSRC = binary.BigEndian.Uint32(body[4:8])
+			packet.Data = body[8:]
+		default:
+			continue
+		}
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+func parseReceptionReports(data []byte, count int) ([]ReceptionReport, error) {
+	if len(data) < count*24 {
+		return nil, fmt.Errorf("rtcp report blocks truncated")
+	}
+	reports := make([]ReceptionReport, count)
+	for i := range reports {
+		block := data[i*24:]
+		lost := int32(binary.BigEndian.Uint32(block[4:8]) & 0xFFFFFF)
+		if lost&0x800000 != 0 {
+			lost -= 1 << 24
+		}
+		reports[i] = ReceptionReport{
+			SSRC:           binary.BigEndian.Uint32(block[0:4]),
+			FractionLost:   block[4],
+			CumulativeLost: lost,
+			HighestSeq:     binary.BigEndian.Uint32(block[8:12]),
+			Jitter:         binary.BigEndian.Uint32(block[12:16]),
+			LSR:            binary.BigEndian.Uint32(block[16:20]),
+			DLSR:           binary.BigEndian.Uint32(block[20:24]),
+		}
+	}
+	return reports, nil
+}
+
+// parseSDESCNAME 返回第一个带 CNAME 的 chunk
+func parseSDESCNAME(data []byte, count int) (uint32, string) {
+	for chunk := 0; chunk < count && len(data) >= 4; chunk++ {
+		ssrc := binary.BigEndian.Uint32(data[0:4])
+		offset := 4
+		cname := ""
+		for offset < len(data) && data[offset] != 0 {
+			if offset+2 > len(data) {
+				return 0, ""
+			}
+			itemType, itemLen := data[offset], int(data[offset+1])
+			if offset+2+itemLen > len(data) {
+				return 0, ""
+			}
+			if itemType == sdesCNAME {
+				cname = string(data[offset+2 : offset+2+itemLen])
+			}
+			offset += 2 + itemLen
+		}
+		if cname != "" {
+			return ssrc, cname
+		}
+		// 结束的 0 之后补齐到 4 字节
+		offset = (offset + 4) &^ 3
+		if offset > len(data) {
+			break
+		}
+		data = data[offset:]
+	}
+	return 0, ""
+}
+
+// ParseNACK 解析 Generic NACK 的 FCI，返回要求重传的序号。
+// 每个 FCI 4 字节: PID(16) + BLP(16)，BLP 第 i 位表示 PID+i+1 也丢了
+func ParseNACK(fci []byte) []uint16 {
+	var seqs []uint16
+	for len(fci) >= 4 {
+		pid := binary.BigEndian.Uint16(fci[0:2])
+		blp := binary.BigEndian.Uint16(fci[2:4])
+		seqs = append(seqs, pid)
+		for i := 0; i < 16; i++ {
+			if blp&(1<<i) != 0 {
+				seqs = append(seqs, pid+uint16(i)+1)
+			}
+		}
+		fci = fci[4:]
+	}
+	return seqs
+}
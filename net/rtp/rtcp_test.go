@@ -0,0 +1,160 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// rtcpPacket 按 RFC 3550 的头部拼一个 RTCP 包，body 需要是 4 字节对齐
+func rtcpPacket(count, packetType uint8, body []byte) []byte {
+	packet := []byte{0x80 | count, packetType, 0, 0}
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(body)/4))
+	return append(packet, body...)
+}
+
+func feedbackBody(sender, media uint32, fci ...byte) []byte {
+	body := binary.BigEndian.AppendUint32(nil, sender)
+	body = binary.BigEndian.AppendUint32(body, media)
+	return append(body, fci...)
+}
+
+func TestParseRTCPFeedback(t *testing.T) {
+	rr := rtcpPacket(0, RTCPTypeRR, binary.BigEndian.AppendUint32(nil, 0x11111111))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []RTCPPacket
+		wantErr bool
+	}{
+		{
+			name: "generic nack",
+			data: rtcpPacket(RTPFBFormatNACK, RTCPTypeRTPFB, feedbackBody(1, 2, 0x00, 0x10, 0x00, 0x05)),
+			want: []RTCPPacket{{Type: RTCPTypeRTPFB, Subtype: RTPFBFormatNACK, SSRC: 1, MediaSSRC: 2, Data: []byte{0x00, 0x10, 0x00, 0x05}}},
+		},
+		{
+			name: "pli",
+			data: rtcpPacket(PSFBFormatPLI, RTCPTypePSFB, feedbackBody(3, 4)),
+			want: []RTCPPacket{{Type: RTCPTypePSFB, Subtype: PSFBFormatPLI, SSRC: 3, MediaSSRC: 4, Data: []byte{}}},
+		},
+		{
+			name: "fir",
+			data: rtcpPacket(PSFBFormatFIR, RTCPTypePSFB, feedbackBody(5, 0, 0, 0, 0, 6, 9, 0, 0, 0)),
+			want: []RTCPPacket{{Type: RTCPTypePSFB, Subtype: PSFBFormatFIR, SSRC: 5, Data: []byte{0, 0, 0, 6, 9, 0, 0, 0}}},
+		},
+		{
+			name: "compound rr and pli",
+			data: append(append([]byte{}, rr...), rtcpPacket(PSFBFormatPLI, RTCPTypePSFB, feedbackBody(1, 2))...),
+			want: []RTCPPacket{
+				{Type: RTCPTypeRR, SSRC: 0x11111111, Reports: []ReceptionReport{}},
+				{Type: RTCPTypePSFB, Subtype: PSFBFormatPLI, SSRC: 1, MediaSSRC: 2, Data: []byte{}},
+			},
+		},
+		{
+			name: "unknown type skipped",
+			data: append(rtcpPacket(0, 210, []byte{1, 2, 3, 4}), rtcpPacket(PSFBFormatPLI, RTCPTypePSFB, feedbackBody(1, 2))...),
+			want: []RTCPPacket{{Type: RTCPTypePSFB, Subtype: PSFBFormatPLI, SSRC: 1, MediaSSRC: 2, Data: []byte{}}},
+		},
+		{
+			name:    "header truncated",
+			data:    []byte{0x81, RTCPTypePSFB, 0},
+			wantErr: true,
+		},
+		{
+			name:    "bad version",
+			data:    []byte{0x41, RTCPTypePSFB, 0, 2, 0, 0, 0, 1, 0, 0, 0, 2},
+			wantErr: true,
+		},
+		{
+			name:    "length beyond data",
+			data:    rtcpPacket(PSFBFormatPLI, RTCPTypePSFB, feedbackBody(1, 2))[:8],
+			wantErr: true,
+		},
+		{
+			name:    "feedback without media ssrc",
+			data:    rtcpPacket(PSFBFormatPLI, RTCPTypePSFB, []byte{0, 0, 0, 1}),
+			wantErr: true,
+		},
+		{
+			name:    "invalid padding",
+			data:    []byte{0xA1, RTCPTypePSFB, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0xFF},
+			wantErr: true,
+		},
+		{
+			name: "padding removed",
+			data: []byte{0xA1, RTCPTypePSFB, 0, 3, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 4},
+			want: []RTCPPacket{{Type: RTCPTypePSFB, Subtype: PSFBFormatPLI, SSRC: 1, MediaSSRC: 2, Data: []byte{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRTCP(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNACK(t *testing.T) {
+	tests := []struct {
+		name string
+		fci  []byte
+		want []uint16
+	}{
+		{
+			name: "pid only",
+			fci:  []byte{0x00, 0x64, 0x00, 0x00},
+			want: []uint16{100},
+		},
+		{
+			name: "bitmask",
+			fci:  []byte{0x00, 0x64, 0x80, 0x01},
+			want: []uint16{100, 101, 116},
+		},
+		{
+			name: "wraps around",
+			fci:  []byte{0xFF, 0xFF, 0x00, 0x03},
+			want: []uint16{65535, 0, 1},
+		},
+		{
+			name: "multiple fci",
+			fci:  []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x0A, 0x00, 0x02},
+			want: []uint16{1, 10, 12},
+		},
+		{
+			name: "trailing bytes ignored",
+			fci:  []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x02},
+			want: []uint16{1},
+		},
+		{
+			name: "empty",
+			fci:  nil,
+			want: nil,
+		},
+		{
+			name: "truncated",
+			fci:  []byte{0x00, 0x01, 0x00},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseNACK(tt.fci); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/binary"
 )
 
-// RTPPacketizer H.265 RTP打包器
+// RTPPacketizer RTP打包器，H.265 和 H.264 共用
 type RTPPacketizer struct {
 	sequenceNumber uint16
 	ssrc           uint32
@@ -22,6 +22,11 @@ func NewRTPPacketizer(payloadType uint8, clockRate uint32) *RTPPacketizer {
 	}
 }
 
+// SetSSRC 修改 SSRC，同一个流的多个轨道各用一个打包器时区分开
+func (p *RTPPacketizer) SetSSRC(ssrc uint32) {
+	p.ssrc = ssrc
+}
+
 // PacketizeH265NALU 将 H.265 NALU 打包成 RTP 包
 func (p *RTPPacketizer) PacketizeH265NALU(nalu []byte, timestamp uint32) [][]byte {
 	var packets [][]byte
@@ -50,6 +55,77 @@ func (p *RTPPacketizer) PacketizeH265NALU(nalu []byte, timestamp uint32) [][]byt
 	return packets
 }
 
+// PacketizeH265Frame 将一个访问单元(同一时间戳的所有 NALU，按解码顺序) 打包成 RTP 包：
+// 连续的小 NALU 聚合成 AP，放不下的 NALU 用单包或 FU，只有整帧的最后一个包置 Marker 位
+func (p *RTPPacketizer) PacketizeH265Frame(nalus [][]byte, timestamp uint32) [][]byte {
+	packets := p.PacketizeH265AP(nalus, timestamp)
+	markFrameEnd(packets)
+	return packets
+}
+
+// PacketizeH265AP 把同一时间戳的多个小 NALU(比如 VPS+SPS+PPS+SEI) 聚合成 AP 包(RFC 7798 4.4.2)，
+// 单个放不进聚合包的 NALU 退回 PacketizeH265NALU
+func (p *RTPPacketizer) PacketizeH265AP(nalus [][]byte, timestamp uint32) [][]byte {
+	var packets [][]byte
+	// AP 的 PayloadHdr(2) 之后每个 NALU 前有 2 字节长度，不带 DONL
+	maxPayload := p.mtuSize - 12
+
+	var group [][]byte
+	groupSize := 2
+	flush := func() {
+		switch len(group) {
+		case 0:
+		case 1:
+			packets = append(packets, p.createSinglePacket(group[0], timestamp))
+		default:
+			packets = append(packets, p.createAPPacket(group, timestamp))
+		}
+		group = nil
+		groupSize = 2
+	}
+
+	for _, nalu := range nalus {
+		if len(nalu) < 2 {
+			continue
+		}
+		if 2+2+len(nalu) > maxPayload {
+			flush()
+			packets = append(packets, p.PacketizeH265NALU(nalu, timestamp)...)
+			continue
+		}
+		if groupSize+2+len(nalu) > maxPayload {
+			flush()
+		}
+		group = append(group, nalu)
+		groupSize += 2 + len(nalu)
+	}
+	flush()
+	return packets
+}
+
+// AP (type 48)，Marker 位和单包模式一样默认置 1
+func (p *RTPPacketizer) createAPPacket(nalus [][]byte, timestamp uint32) []byte {
+	// PayloadHdr: F 取所有 NALU 的或，LayerId 和 TID 取最小值
+	var f byte
+	layerID, tid := byte(0x3F), byte(0x07)
+	for _, nalu := range nalus {
+		f |= nalu[0] & 0x80
+		if id := (nalu[0]&0x01)<<5 | nalu[1]>>3; id < layerID {
+			layerID = id
+		}
+		if t := nalu[1] & 0x07; t < tid {
+			tid = t
+		}
+	}
+
+	payload := []byte{f | 48<<1 | layerID>>5, (layerID&0x1F)<<3 | tid}
+	for _, nalu := range nalus {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	return p.createSinglePacket(payload, timestamp)
+}
+
 // 单包 RTP
 func (p *RTPPacketizer) createSinglePacket(nalu []byte, timestamp uint32) []byte {
 	rtpHeader := make([]byte, 12)
@@ -57,7 +133,7 @@ func (p *RTPPacketizer) createSinglePacket(nalu []byte, timestamp uint32) []byte
 	rtpHeader[1] = p.payloadType & 0x7F
 
 	// 注意：单包模式下，我们默认置 1。
-	// 但在 export.go 的 sendInternal 里，我们会根据是否是这一帧的最后一个 NALU 来手动修改它。
+	// 按帧打包(PacketizeH265Frame / AccessUnitPacketizer)时只保留一帧最后一个包的 Marker 位
 	rtpHeader[1] |= 0x80
 
 	binary.BigEndian.PutUint16(rtpHeader[2:4], p.sequenceNumber)
@@ -100,7 +176,7 @@ func (p *RTPPacketizer) createFUPackets(nalu []byte, timestamp uint32, nalType u
 		// 如果是最后一个分片，设置 Marker 位
 		// 注意：这只是针对这个 NALU 的最后一个分片。
 		// 如果这个 NALU 本身不是一帧的最后一个（比如是 VPS），
-		// export.go 里的逻辑会再次把这个位抹去，这是安全的。
+		// 按帧打包时会再次把这个位抹去，这是安全的。
 		if offset+chunkSize == payloadLen {
 			rtpHeader[1] |= 0x80
 		}
@@ -146,3 +222,25 @@ func (p *RTPPacketizer) createFUPackets(nalu []byte, timestamp uint32, nalType u
 
 	return packets
 }
+
+// IsH265KeyframeStart 判断 RTP 负载是否是一个关键帧的开始：
+// VPS/SPS/PPS 单包、IRAP 单包、以它们开头的 AP、IRAP 的第一个 FU 分片
+func IsH265KeyframeStart(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	nalType := (payload[0] >> 1) & 0x3F
+	switch {
+	case nalType >= 32 && nalType <= 34:
+		return true
+	case nalType >= 19 && nalType <= 21:
+		return true
+	case nalType == 48 && len(payload) >= 5:
+		// AP: 第一个 NALU 的头在 PayloadHdr(2) + 长度(2) 之后
+		return IsH265KeyframeStart(payload[4:])
+	case nalType == 49 && len(payload) >= 3:
+		fuType := payload[2] & 0x3F
+		return payload[2]&0x80 != 0 && fuType >= 19 && fuType <= 21
+	}
+	return false
+}
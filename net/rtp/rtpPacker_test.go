@@ -0,0 +1,257 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// h265NALU 生成一个 LayerId=0、TID=1 的 NALU，总长 size
+func h265NALU(nalType byte, size int) []byte {
+	nalu := make([]byte, size)
+	for i := range nalu {
+		nalu[i] = byte(i)
+	}
+	nalu[0] = nalType << 1
+	nalu[1] = 0x01
+	return nalu
+}
+
+// h265Depacketize 把单包、AP、FU 还原成 NALU，用来检查打包结果
+func h265Depacketize(t *testing.T, packets [][]byte) [][]byte {
+	t.Helper()
+	var nalus [][]byte
+	var fragment []byte
+	for i, packet := range packets {
+		if len(packet) < 14 {
+			t.Fatalf("packet %d too short: % X", i, packet)
+		}
+		payload := packet[12:]
+		switch (payload[0] >> 1) & 0x3F {
+		case 48:
+			for rest := payload[2:]; len(rest) > 0; {
+				if len(rest) < 2 {
+					t.Fatalf("packet %d ap truncated", i)
+				}
+				size := int(binary.BigEndian.Uint16(rest))
+				if len(rest) < 2+size {
+					t.Fatalf("packet %d ap nalu truncated", i)
+				}
+				nalus = append(nalus, rest[2:2+size])
+				rest = rest[2+size:]
+			}
+		case 49:
+			if len(payload) < 3 {
+				t.Fatalf("packet %d fu truncated", i)
+			}
+			fu := payload[2]
+			if fu&0x80 != 0 {
+				fragment = []byte{payload[0]&0x81 | (fu&0x3F)<<1, payload[1]}
+			} else if fragment == nil {
+				t.Fatalf("packet %d fu without start", i)
+			}
+			fragment = append(fragment, payload[3:]...)
+			if fu&0x40 != 0 {
+				nalus = append(nalus, fragment)
+				fragment = nil
+			}
+		default:
+			nalus = append(nalus, payload)
+		}
+	}
+	if fragment != nil {
+		t.Fatal("fu without end")
+	}
+	return nalus
+}
+
+func TestPacketizeH265AP(t *testing.T) {
+	vps, sps, pps := h265NALU(32, 24), h265NALU(33, 40), h265NALU(34, 8)
+	large := h265NALU(19, 3000)
+
+	tests := []struct {
+		name    string
+		nalus   [][]byte
+		headers [][2]byte // 每个包的 PayloadHdr
+		want    [][]byte
+	}{
+		{
+			name:    "parameter sets aggregated",
+			nalus:   [][]byte{vps, sps, pps},
+			headers: [][2]byte{{48 << 1, 0x01}},
+			want:    [][]byte{vps, sps, pps},
+		},
+		{
+			name:    "f bit or and minimum layer id and tid",
+			nalus:   [][]byte{{0x80 | 1<<1 | 0x01, 0x13, 0xAA}, {1 << 1, 0x0A, 0xBB}},
+			headers: [][2]byte{{0x80 | 48<<1, 0x0A}},
+			want:    [][]byte{{0x80 | 1<<1 | 0x01, 0x13, 0xAA}, {1 << 1, 0x0A, 0xBB}},
+		},
+		{
+			name:    "single nalu not aggregated",
+			nalus:   [][]byte{sps},
+			headers: [][2]byte{{33 << 1, 0x01}},
+			want:    [][]byte{sps},
+		},
+		{
+			name:    "group flushed before large nalu",
+			nalus:   [][]byte{vps, sps, large, pps},
+			headers: [][2]byte{{48 << 1, 0x01}, {49 << 1, 0x01}, {49 << 1, 0x01}, {49 << 1, 0x01}, {34 << 1, 0x01}},
+			want:    [][]byte{vps, sps, large, pps},
+		},
+		{
+			name:    "group split at mtu",
+			nalus:   [][]byte{h265NALU(1, 800), h265NALU(1, 800)},
+			headers: [][2]byte{{1 << 1, 0x01}, {1 << 1, 0x01}},
+			want:    [][]byte{h265NALU(1, 800), h265NALU(1, 800)},
+		},
+		{
+			name:    "short nalus skipped",
+			nalus:   [][]byte{nil, {0x40}, pps},
+			headers: [][2]byte{{34 << 1, 0x01}},
+			want:    [][]byte{pps},
+		},
+		{
+			name:  "empty",
+			nalus: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewRTPPacketizer(96, 90000)
+			packets := p.PacketizeH265AP(tt.nalus, 1000)
+			if len(packets) != len(tt.headers) {
+				t.Fatalf("got %d packets, want %d", len(packets), len(tt.headers))
+			}
+			for i, packet := range packets {
+				if len(packet) > 1400 {
+					t.Errorf("packet %d is %d bytes, over mtu", i, len(packet))
+				}
+				if got := [2]byte{packet[12], packet[13]}; got != tt.headers[i] {
+					t.Errorf("packet %d payload header = % X, want % X", i, got, tt.headers[i])
+				}
+				if got := binary.BigEndian.Uint16(packet[2:4]); got != uint16(i+1) {
+					t.Errorf("packet %d sequence = %d", i, got)
+				}
+			}
+			if got := h265Depacketize(t, packets); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %d nalus, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPacketizeH265NALU(t *testing.T) {
+	tests := []struct {
+		name    string
+		nalu    []byte
+		packets int
+	}{
+		{name: "single packet", nalu: h265NALU(19, 1388), packets: 1},
+		{name: "two fragments", nalu: h265NALU(19, 1389), packets: 2},
+		{name: "many fragments", nalu: h265NALU(1, 5000), packets: 4},
+		{name: "layer id and f bit kept", nalu: append([]byte{0x80 | 20<<1 | 0x01, 0xFA}, make([]byte, 2000)...), packets: 2},
+		{name: "header only", nalu: []byte{1 << 1, 0x01}, packets: 1},
+		{name: "too short", nalu: []byte{0x02}, packets: 0},
+		{name: "empty", nalu: nil, packets: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewRTPPacketizer(96, 90000)
+			packets := p.PacketizeH265NALU(tt.nalu, 1000)
+			if len(packets) != tt.packets {
+				t.Fatalf("got %d packets, want %d", len(packets), tt.packets)
+			}
+			if tt.packets == 0 {
+				return
+			}
+
+			for i, packet := range packets {
+				if len(packet) > 1400 {
+					t.Errorf("packet %d is %d bytes, over mtu", i, len(packet))
+				}
+				marker := packet[1]&0x80 != 0
+				if marker != (i == len(packets)-1) {
+					t.Errorf("packet %d marker = %v", i, marker)
+				}
+				if tt.packets == 1 {
+					continue
+				}
+
+				payload := packet[12:]
+				if payload[0] != tt.nalu[0]&0x81|49<<1 || payload[1] != tt.nalu[1] {
+					t.Errorf("packet %d payload header = % X", i, payload[:2])
+				}
+				fu := payload[2]
+				if start := fu&0x80 != 0; start != (i == 0) {
+					t.Errorf("packet %d S = %v", i, start)
+				}
+				if end := fu&0x40 != 0; end != (i == len(packets)-1) {
+					t.Errorf("packet %d E = %v", i, end)
+				}
+				if fuType := fu & 0x3F; fuType != (tt.nalu[0]>>1)&0x3F {
+					t.Errorf("packet %d FuType = %d", i, fuType)
+				}
+			}
+			if got := h265Depacketize(t, packets); len(got) != 1 || !bytes.Equal(got[0], tt.nalu) {
+				t.Fatal("reassembled nalu does not match")
+			}
+		})
+	}
+}
+
+// 按帧打包时只有整帧最后一个包带 Marker 位
+func TestPacketizeH265Frame(t *testing.T) {
+	tests := []struct {
+		name    string
+		nalus   [][]byte
+		packets int
+	}{
+		{name: "parameter sets and fragmented idr", nalus: [][]byte{h265NALU(32, 24), h265NALU(33, 40), h265NALU(34, 8), h265NALU(19, 3000)}, packets: 4},
+		{name: "idr then small trailing nalu", nalus: [][]byte{h265NALU(19, 3000), h265NALU(39, 10)}, packets: 4},
+		{name: "single nalu", nalus: [][]byte{h265NALU(1, 100)}, packets: 1},
+		{name: "empty", nalus: nil, packets: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets := NewRTPPacketizer(96, 90000).PacketizeH265Frame(tt.nalus, 1000)
+			if len(packets) != tt.packets {
+				t.Fatalf("got %d packets, want %d", len(packets), tt.packets)
+			}
+			for i, packet := range packets {
+				if marker := packet[1]&0x80 != 0; marker != (i == len(packets)-1) {
+					t.Errorf("packet %d marker = %v", i, marker)
+				}
+			}
+		})
+	}
+}
+
+func TestIsH265KeyframeStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{name: "vps", payload: []byte{32 << 1, 0x01, 0x0C}, want: true},
+		{name: "idr", payload: []byte{19 << 1, 0x01, 0xAF}, want: true},
+		{name: "trail", payload: []byte{1 << 1, 0x01, 0xAF}, want: false},
+		{name: "ap starting with vps", payload: []byte{48 << 1, 0x01, 0x00, 0x02, 32 << 1, 0x01}, want: true},
+		{name: "ap starting with sei", payload: []byte{48 << 1, 0x01, 0x00, 0x02, 39 << 1, 0x01}, want: false},
+		{name: "ap truncated", payload: []byte{48 << 1, 0x01, 0x00, 0x02}, want: false},
+		{name: "fu start of idr", payload: []byte{49 << 1, 0x01, 0x80 | 19}, want: true},
+		{name: "fu middle of idr", payload: []byte{49 << 1, 0x01, 19}, want: false},
+		{name: "fu start of trail", payload: []byte{49 << 1, 0x01, 0x80 | 1}, want: false},
+		{name: "fu truncated", payload: []byte{49 << 1, 0x01}, want: false},
+		{name: "too short", payload: []byte{32 << 1}, want: false},
+	}
+	for _, tt := range tests {
+		if got := IsH265KeyframeStart(tt.payload); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
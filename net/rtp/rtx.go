@@ -0,0 +1,26 @@
+package rtp
+
+import (
+	"encoding/binary"
+)
+
+// BuildRTXPacket 按 RFC 4588 把原始 RTP 包封装成重传包，
+// 负载前加 2 字节原始序号(OSN)，使用 RTX 的负载类型、序号和 SSRC，时间戳和 marker 不变
+func BuildRTXPacket(original []byte, payloadType uint8, sequence uint16, ssrc uint32) []byte {
+	header, payload, err := ParseRTPPacket(original)
+	if err != nil {
+		return nil
+	}
+
+	rtx := make([]byte, 2+len(payload))
+	binary.BigEndian.PutUint16(rtx[0:2], header.SequenceNumber)
+	copy(rtx[2:], payload)
+
+	return BuildRTPPacket(RTPHeader{
+		Marker:         header.Marker,
+		PayloadType:    payloadType,
+		SequenceNumber: sequence,
+		Timestamp:      header.Timestamp,
+		SSRC:           ssrc,
+	}, rtx)
+}
@@ -0,0 +1,282 @@
+package rtsp
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+type AuthMode int
+
+const (
+	AuthDigest AuthMode = iota // 0: RFC 2617/7616 Digest，默认
+	AuthBasic                  // 1: Basic，只建议在 RTSPS 下使用
+)
+
+// Authenticator 提供用户凭证和按路径的权限判断，通过 RTSPServerInitConfig 设置
+type Authenticator interface {
+	// Password 返回用户的明文密码，用户不存在返回 false
+	Password(username string) (string, bool)
+	// Authorize 判断已经通过认证的用户能否访问 streamPath
+	Authorize(username string, streamPath string) bool
+}
+
+// StaticAuthenticator 内置的静态用户表，
+// 没有调用 RestrictPath 的路径所有用户都能访问
+type StaticAuthenticator struct {
+	users map[string]string
+	paths map[string]map[string]bool
+	mu    sync.RWMutex
+}
+
+func NewStaticAuthenticator() *StaticAuthenticator {
+	return &StaticAuthenticator{
+		users: make(map[string]string),
+		paths: make(map[string]map[string]bool),
+	}
+}
+
+func (a *StaticAuthenticator) AddUser(username, password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[username] = password
+}
+
+func (a *StaticAuthenticator) RemoveUser(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.users, username)
+}
+
+// RestrictPath 限制 streamPath 只允许 usernames 访问
+func (a *StaticAuthenticator) RestrictPath(streamPath string, usernames ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	allowed := make(map[string]bool)
+	for _, name := range usernames {
+		allowed[name] = true
+	}
+	a.paths[streamPath] = allowed
+}
+
+func (a *StaticAuthenticator) Password(username string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	password, ok := a.users[username]
+	return password, ok
+}
+
+func (a *StaticAuthenticator) Authorize(username string, streamPath string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	allowed, restricted := a.paths[streamPath]
+	if !restricted {
+		return true
+	}
+	return allowed[username]
+}
+
+// connAuth 保存一个 RTSP 连接上的认证状态
+type connAuth struct {
+	nonce    string
+	nonceAt  time.Time // nonce 生成时间，超过 nonceLifetime 后换新的
+	username string
+	nc       uint64 // 当前 nonce 下已经用过的最大 nonce-count，防止重放
+}
+
+func (a *connAuth) newNonce() {
+	a.nonce = utils.GenerateSessionID()
+	a.nonceAt = time.Now()
+	a.nc = 0
+}
+
+func requiresAuth(method string) bool {
+	switch method {
+	case MethodDescribe, MethodSetup, MethodPlay, MethodAnnounce, MethodRecord,
+		MethodGetParameter, MethodSetParameter:
+		return true
+	}
+	return false
+}
+
+// checkAuth 校验请求的 Authorization 头，失败时返回 401/403 响应
+func (s *RTSPServer) checkAuth(req *RTSPRequest, cseq int, streamPath string, state *connAuth) (string, bool) {
+	if state.nonce == "" {
+		state.newNonce()
+	}
+
+	if authorization, ok := req.Headers["Authorization"]; ok {
+		username, valid, stale := s.verifyAuthorization(req, authorization, state)
+		if stale {
+			// 凭证正确但 nonce 过期，客户端可以直接用新的 nonce 重新计算，不需要再问用户
+			utils.Debug("Digest nonce expired for user %q", username)
+			state.newNonce()
+			return s.buildUnauthorized(cseq, state, true), false
+		}
+		if !valid {
+			utils.Warn("Authentication failed for user %q", username)
+			return s.buildUnauthorized(cseq, state, false), false
+		}
+		state.username = username
+	} else if state.username == "" {
+		// 有些客户端认证成功后不会在每个请求里都带 Authorization
+		return s.buildUnauthorized(cseq, state, false), false
+	}
+
+	if !s.authenticator.Authorize(state.username, streamPath) {
+		utils.Warn("User %q not allowed on %s", state.username, streamPath)
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(403, "Forbidden", headers, ""), false
+	}
+	return "", true
+}
+
+func (s *RTSPServer) buildUnauthorized(cseq int, state *connAuth, stale bool) string {
+	var challenge string
+	if s.authMode == AuthBasic {
+		challenge = fmt.Sprintf(`Basic realm="%s"`, s.authRealm)
+	} else {
+		challenge = fmt.Sprintf(`Digest realm="%s", nonce="%s", algorithm=MD5, qop="auth"`, s.authRealm, state.nonce)
+		if stale {
+			challenge += ", stale=true"
+		}
+	}
+	headers := map[string]string{
+		"CSeq":             fmt.Sprintf("%d", cseq),
+		"Server":           s.serverName,
+		"WWW-Authenticate": challenge,
+	}
+	return BuildRTSPResponse(401, "Unauthorized", headers, "")
+}
+
+// verifyAuthorization 校验 Authorization 头，stale 表示 Digest 凭证正确但 nonce 已经过期
+func (s *RTSPServer) verifyAuthorization(req *RTSPRequest, authorization string, state *connAuth) (username string, valid bool, stale bool) {
+	nonce := state.nonce
+	scheme, credentials, _ := strings.Cut(authorization, " ")
+	credentials = strings.TrimSpace(credentials)
+
+	switch {
+	case strings.EqualFold(scheme, "Basic") && s.authMode == AuthBasic:
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return "", false, false
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return "", false, false
+		}
+		expected, exists := s.authenticator.Password(username)
+		if !exists {
+			return username, false, false
+		}
+		return username, subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1, false
+
+	case strings.EqualFold(scheme, "Digest") && s.authMode == AuthDigest:
+		params := parseAuthParams(credentials)
+		username := params["username"]
+		if params["nonce"] != nonce || params["realm"] != s.authRealm {
+			return username, false, false
+		}
+		// response 只对 uri 有效，不能拿别的请求的 Authorization 来用
+		if params["uri"] != req.URL {
+			return username, false, false
+		}
+		password, exists := s.authenticator.Password(username)
+		if !exists {
+			return username, false, false
+		}
+
+		hash := md5Hex
+		if strings.EqualFold(params["algorithm"], "SHA-256") {
+			hash = sha256Hex
+		}
+		ha1 := hash(username + ":" + s.authRealm + ":" + password)
+		ha2 := hash(req.Method + ":" + params["uri"])
+
+		var expected string
+		var nc uint64
+		qop := params["qop"]
+		switch qop {
+		case "auth":
+			var err error
+			if nc, err = strconv.ParseUint(params["nc"], 16, 32); err != nil {
+				return username, false, false
+			}
+			expected = hash(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":" + qop + ":" + ha2)
+		case "":
+			// RFC 2069 兼容(live555 之类的客户端不带 qop)，没有 nc 无法防重放，
+			// 只能靠 nonce 的有效期限制一个截获的 response 能用多久
+			expected = hash(ha1 + ":" + nonce + ":" + ha2)
+		default:
+			return username, false, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+			return username, false, false
+		}
+		if time.Since(state.nonceAt) > s.nonceLifetime {
+			return username, false, true
+		}
+		if qop != "" {
+			// 同一个 nonce 下 nc 必须递增，重复的是重放
+			if nc <= state.nc {
+				return username, false, false
+			}
+			state.nc = nc
+		}
+		return username, true, false
+	}
+
+	return "", false, false
+}
+
+// parseAuthParams 解析 key="value", key=value 形式的参数列表
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if comma := strings.Index(s, ","); comma >= 0 {
+			value, s = strings.TrimSpace(s[:comma]), s[comma+1:]
+		} else {
+			value, s = strings.TrimSpace(s), ""
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
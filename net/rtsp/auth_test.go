@@ -0,0 +1,269 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAuthTestServer(t *testing.T, mode AuthMode) *RTSPServer {
+	t.Helper()
+	auth := NewStaticAuthenticator()
+	auth.AddUser("alice", "secret")
+	auth.AddUser("bob", "hunter2")
+	auth.RestrictPath("private", "alice")
+	server := newTestServer(t, RTSPServerInitConfig{Authenticator: auth, AuthMode: mode, AuthRealm: "test realm"})
+	server.AddPath("live")
+	server.AddPath("private")
+	return server
+}
+
+// digestChallenge 发一个不带认证的请求，返回 WWW-Authenticate 里的参数
+func digestChallenge(t *testing.T, client *testClient, url string) map[string]string {
+	t.Helper()
+	resp := client.request(t, MethodDescribe, url, nil)
+	if resp.status != 401 {
+		t.Fatalf("status = %d, want 401", resp.status)
+	}
+	scheme, params, _ := strings.Cut(resp.headers["WWW-Authenticate"], " ")
+	if scheme != "Digest" {
+		t.Fatalf("challenge = %q", resp.headers["WWW-Authenticate"])
+	}
+	return parseAuthParams(params)
+}
+
+// digestAuthorization 按 RFC 2617 计算 Authorization 头，qop 为空时是 RFC 2069 的算法
+func digestAuthorization(username, password, realm, nonce, method, uri, qop string, nc int) string {
+	ha1 := md5Hex(username + ":" + realm + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+	if qop == "" {
+		response := md5Hex(ha1 + ":" + nonce + ":" + ha2)
+		return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			username, realm, nonce, uri, response)
+	}
+	ncValue := fmt.Sprintf("%08x", nc)
+	response := md5Hex(ha1 + ":" + nonce + ":" + ncValue + ":0a4f113b:" + qop + ":" + ha2)
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=%s, nc=%s, cnonce="0a4f113b", response="%s"`,
+		username, realm, nonce, uri, qop, ncValue, response)
+}
+
+func TestBasicAuth(t *testing.T) {
+	server := newAuthTestServer(t, AuthBasic)
+	basic := func(username, password string) map[string]string {
+		return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))}
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		want    int
+	}{
+		{name: "no credentials", url: "rtsp://host/live", want: 401},
+		{name: "valid", url: "rtsp://host/live", headers: basic("bob", "hunter2"), want: 200},
+		{name: "wrong password", url: "rtsp://host/live", headers: basic("bob", "secret"), want: 401},
+		{name: "unknown user", url: "rtsp://host/live", headers: basic("carol", "secret"), want: 401},
+		{name: "malformed", url: "rtsp://host/live", headers: map[string]string{"Authorization": "Basic !!!"}, want: 401},
+		{name: "digest not accepted", url: "rtsp://host/live", headers: map[string]string{"Authorization": `Digest username="bob"`}, want: 401},
+		{name: "restricted path allowed", url: "rtsp://host/private", headers: basic("alice", "secret"), want: 200},
+		{name: "restricted path denied", url: "rtsp://host/private", headers: basic("bob", "hunter2"), want: 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, server)
+			resp := client.request(t, MethodDescribe, tt.url, tt.headers)
+			if resp.status != tt.want {
+				t.Fatalf("status = %d, want %d", resp.status, tt.want)
+			}
+			if tt.want == 401 && resp.headers["WWW-Authenticate"] != `Basic realm="test realm"` {
+				t.Fatalf("challenge = %q", resp.headers["WWW-Authenticate"])
+			}
+		})
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	server := newAuthTestServer(t, AuthDigest)
+	const url = "rtsp://host/live"
+
+	tests := []struct {
+		name string
+		// authorization 用 challenge 里的 nonce 生成 Authorization 头
+		authorization func(nonce string) string
+		want          int
+	}{
+		{
+			name: "qop auth",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, "auth", 1)
+			},
+			want: 200,
+		},
+		{
+			name: "without qop",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, "", 0)
+			},
+			want: 200,
+		},
+		{
+			name: "unsupported qop",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, "auth-int", 1)
+			},
+			want: 401,
+		},
+		{
+			name: "wrong password",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "secret", "test realm", nonce, MethodDescribe, url, "auth", 1)
+			},
+			want: 401,
+		},
+		{
+			name: "wrong realm",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "other", nonce, MethodDescribe, url, "auth", 1)
+			},
+			want: 401,
+		},
+		{
+			name: "wrong uri",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, "rtsp://host/other", "auth", 1)
+			},
+			want: 401,
+		},
+		{
+			name: "wrong nonce",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "test realm", "0123456789", MethodDescribe, url, "auth", 1)
+			},
+			want: 401,
+		},
+		{
+			name: "wrong method",
+			authorization: func(nonce string) string {
+				return digestAuthorization("bob", "hunter2", "test realm", nonce, MethodSetup, url, "auth", 1)
+			},
+			want: 401,
+		},
+		{
+			name: "bad nc",
+			authorization: func(nonce string) string {
+				return strings.Replace(digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, "auth", 1), "nc=00000001", "nc=zz", 1)
+			},
+			want: 401,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, server)
+			challenge := digestChallenge(t, client, url)
+			if challenge["realm"] != "test realm" || challenge["qop"] != "auth" || challenge["nonce"] == "" {
+				t.Fatalf("challenge = %v", challenge)
+			}
+			resp := client.request(t, MethodDescribe, url, map[string]string{"Authorization": tt.authorization(challenge["nonce"])})
+			if resp.status != tt.want {
+				t.Fatalf("status = %d, want %d", resp.status, tt.want)
+			}
+		})
+	}
+}
+
+// 同一个 nonce 下 nc 不能重复或回退
+func TestDigestAuthReplayedNC(t *testing.T) {
+	server := newAuthTestServer(t, AuthDigest)
+	const url = "rtsp://host/live"
+	client := newTestClient(t, server)
+	nonce := digestChallenge(t, client, url)["nonce"]
+
+	for _, step := range []struct {
+		nc   int
+		want int
+	}{
+		{nc: 1, want: 200},
+		{nc: 1, want: 401},
+		{nc: 2, want: 200},
+		{nc: 5, want: 200},
+		{nc: 3, want: 401},
+		{nc: 6, want: 200},
+	} {
+		authorization := digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, "auth", step.nc)
+		resp := client.request(t, MethodDescribe, url, map[string]string{"Authorization": authorization})
+		if resp.status != step.want {
+			t.Fatalf("nc %d: status = %d, want %d", step.nc, resp.status, step.want)
+		}
+	}
+}
+
+// nonce 过期后正确的凭证得到 stale=true 和新的 nonce，旧 nonce 的 response 不再有效
+func TestDigestAuthStaleNonce(t *testing.T) {
+	server := newAuthTestServer(t, AuthDigest)
+	server.nonceLifetime = 50 * time.Millisecond
+	const url = "rtsp://host/live"
+
+	for _, qop := range []string{"", "auth"} {
+		t.Run("qop="+qop, func(t *testing.T) {
+			client := newTestClient(t, server)
+			nonce := digestChallenge(t, client, url)["nonce"]
+			authorization := digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, qop, 1)
+			if resp := client.request(t, MethodDescribe, url, map[string]string{"Authorization": authorization}); resp.status != 200 {
+				t.Fatalf("fresh nonce: status = %d", resp.status)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			authorization = digestAuthorization("bob", "hunter2", "test realm", nonce, MethodDescribe, url, qop, 2)
+			resp := client.request(t, MethodDescribe, url, map[string]string{"Authorization": authorization})
+			if resp.status != 401 {
+				t.Fatalf("expired nonce: status = %d, want 401", resp.status)
+			}
+			challenge := parseAuthParams(strings.TrimPrefix(resp.headers["WWW-Authenticate"], "Digest "))
+			if challenge["stale"] != "true" || challenge["nonce"] == "" || challenge["nonce"] == nonce {
+				t.Fatalf("challenge = %v", challenge)
+			}
+
+			// 重放过期 nonce 的 response 仍然失败，nc 从新的 nonce 重新开始
+			if resp := client.request(t, MethodDescribe, url, map[string]string{"Authorization": authorization}); resp.status != 401 {
+				t.Fatalf("replayed expired nonce: status = %d, want 401", resp.status)
+			}
+			authorization = digestAuthorization("bob", "hunter2", "test realm", challenge["nonce"], MethodDescribe, url, qop, 1)
+			if resp := client.request(t, MethodDescribe, url, map[string]string{"Authorization": authorization}); resp.status != 200 {
+				t.Fatalf("new nonce: status = %d", resp.status)
+			}
+		})
+	}
+}
+
+// 认证通过但没有路径权限返回 403，错误的凭证不会泄露路径权限
+func TestDigestAuthPathDenied(t *testing.T) {
+	server := newAuthTestServer(t, AuthDigest)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		url      string
+		want     int
+	}{
+		{name: "allowed user", username: "alice", password: "secret", url: "rtsp://host/private", want: 200},
+		{name: "other user", username: "bob", password: "hunter2", url: "rtsp://host/private", want: 403},
+		{name: "other user wrong password", username: "bob", password: "nope", url: "rtsp://host/private", want: 401},
+		{name: "unrestricted path", username: "bob", password: "hunter2", url: "rtsp://host/live", want: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, server)
+			nonce := digestChallenge(t, client, tt.url)["nonce"]
+			authorization := digestAuthorization(tt.username, tt.password, "test realm", nonce, MethodDescribe, tt.url, "auth", 1)
+			if resp := client.request(t, MethodDescribe, tt.url, map[string]string{"Authorization": authorization}); resp.status != tt.want {
+				t.Fatalf("status = %d, want %d", resp.status, tt.want)
+			}
+		})
+	}
+}
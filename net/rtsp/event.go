@@ -0,0 +1,44 @@
+package rtsp
+
+type SessionEventType int
+
+const (
+	EventSessionTimeout SessionEventType = iota // 0: 超时未活动，被服务端回收
+	EventPublishStart                           // 1: 推流端开始 RECORD
+	EventPublishStop                            // 2: 推流端断开或 TEARDOWN
+)
+
+func (t SessionEventType) String() string {
+	switch t {
+	case EventSessionTimeout:
+		return "timeout"
+	case EventPublishStart:
+		return "publish_start"
+	case EventPublishStop:
+		return "publish_stop"
+	}
+	return "unknown"
+}
+
+// SessionEvent 通过 RTSPServerInitConfig.OnSessionEvent 通知给应用层
+type SessionEvent struct {
+	Type       SessionEventType
+	SessionID  string
+	StreamPath string
+	RemoteAddr string
+}
+
+func (s *RTSPServer) emitEvent(eventType SessionEventType, session *StreamSession) {
+	if s.onSessionEvent == nil || session == nil {
+		return
+	}
+	event := SessionEvent{
+		Type:       eventType,
+		SessionID:  session.SessionID,
+		StreamPath: session.StreamPath,
+	}
+	if conn := session.rtspConn(); conn != nil {
+		event.RemoteAddr = conn.RemoteAddr().String()
+	}
+	s.onSessionEvent(event)
+}
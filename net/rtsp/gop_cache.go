@@ -0,0 +1,87 @@
+package rtsp
+
+import (
+	"github.com/tthhr/go_rtsp/net/rtp"
+)
+
+const defaultGOPCacheBytes = 4 * 1024 * 1024
+
+// cachedPacket GOP 缓存中的一个 RTP 包
+type cachedPacket struct {
+	data      []byte
+	timestamp uint32
+}
+
+// gopCache 缓存最近一个关键帧(包括前面的参数集)开始的所有 RTP 包，
+// 新的播放端先收到这一段，不用等下一个 IDR
+type gopCache struct {
+	enabled  bool
+	maxBytes int
+	packets  []cachedPacket
+	size     int
+	startTS  uint32
+}
+
+func (c *gopCache) configure(enabled bool, maxBytes int) {
+	if maxBytes <= 0 {
+		maxBytes = defaultGOPCacheBytes
+	}
+	c.enabled = enabled
+	c.maxBytes = maxBytes
+	c.reset()
+}
+
+func (c *gopCache) reset() {
+	c.packets = nil
+	c.size = 0
+}
+
+// add 缓存一个包，遇到新的关键帧时丢掉上一个 GOP
+func (c *gopCache) add(media *MediaDescription, data []byte, timestamp uint32) {
+	if !c.enabled || len(data) < 12 {
+		return
+	}
+
+	// 参数集和 IDR 的时间戳相同，只有时间戳变化的关键帧才是新的 GOP
+	if keyframeStart(media, data[12:]) && (len(c.packets) == 0 || timestamp != c.startTS) {
+		c.reset()
+		c.startTS = timestamp
+	} else if len(c.packets) == 0 {
+		// 还没等到关键帧
+		return
+	}
+
+	if c.size+len(data) > c.maxBytes {
+		// GOP 太大，放弃这个 GOP，等下一个关键帧
+		c.reset()
+		return
+	}
+	c.packets = append(c.packets, cachedPacket{data: data, timestamp: timestamp})
+	c.size += len(data)
+}
+
+func (c *gopCache) snapshot() []cachedPacket {
+	if len(c.packets) == 0 {
+		return nil
+	}
+	packets := make([]cachedPacket, len(c.packets))
+	copy(packets, c.packets)
+	return packets
+}
+
+// keyframeStart 按编码判断负载是否是关键帧的开始，不认识的编码当作每个包都可以开始
+func keyframeStart(media *MediaDescription, payload []byte) bool {
+	if media == nil {
+		return rtp.IsH265KeyframeStart(payload)
+	}
+	switch media.Encoding {
+	case "H265":
+		return rtp.IsH265KeyframeStart(payload)
+	case "H264":
+		return rtp.IsH264KeyframeStart(payload)
+	case "JPEG":
+		// 每帧都能独立解码，从一帧的第一个分片开始即可
+		return rtp.IsJPEGFrameStart(payload)
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// h265Packet 一个单 NALU 的 RTP 包，id 放在负载最后一个字节，用来区分包
+func h265Packet(nalType byte, timestamp uint32, id byte) []byte {
+	packet := make([]byte, 12, 16)
+	packet[0] = 0x80
+	packet[1] = 96
+	binary.BigEndian.PutUint32(packet[4:8], timestamp)
+	return append(packet, nalType<<1, 0x01, 0xAF, id)
+}
+
+func cachedIDs(packets []cachedPacket) []byte {
+	var ids []byte
+	for _, packet := range packets {
+		ids = append(ids, packet.data[len(packet.data)-1])
+	}
+	return ids
+}
+
+func TestGOPCacheAdd(t *testing.T) {
+	type add struct {
+		nalType   byte
+		timestamp uint32
+		id        byte
+	}
+	tests := []struct {
+		name     string
+		enabled  bool
+		maxBytes int
+		adds     []add
+		want     []byte // 缓存里剩下的包
+	}{
+		{
+			name:    "wait for keyframe",
+			enabled: true,
+			adds:    []add{{1, 0, 1}, {1, 3000, 2}, {19, 6000, 3}, {1, 9000, 4}},
+			want:    []byte{3, 4},
+		},
+		{
+			name:    "parameter sets and idr share a gop",
+			enabled: true,
+			adds:    []add{{32, 3000, 1}, {33, 3000, 2}, {34, 3000, 3}, {19, 3000, 4}, {1, 6000, 5}},
+			want:    []byte{1, 2, 3, 4, 5},
+		},
+		{
+			name:    "new keyframe resets",
+			enabled: true,
+			adds:    []add{{32, 3000, 1}, {19, 3000, 2}, {1, 6000, 3}, {32, 9000, 4}, {19, 9000, 5}, {1, 12000, 6}},
+			want:    []byte{4, 5, 6},
+		},
+		{
+			name:     "gop over max bytes dropped until next keyframe",
+			enabled:  true,
+			maxBytes: 3 * 16,
+			adds:     []add{{19, 3000, 1}, {1, 6000, 2}, {1, 9000, 3}, {1, 12000, 4}, {1, 15000, 5}, {19, 18000, 6}, {1, 21000, 7}},
+			want:     []byte{6, 7},
+		},
+		{
+			name:     "gop fits max bytes",
+			enabled:  true,
+			maxBytes: 3 * 16,
+			adds:     []add{{19, 3000, 1}, {1, 6000, 2}, {1, 9000, 3}},
+			want:     []byte{1, 2, 3},
+		},
+		{
+			name:    "disabled",
+			enabled: false,
+			adds:    []add{{19, 3000, 1}, {1, 6000, 2}},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cache gopCache
+			cache.configure(tt.enabled, tt.maxBytes)
+			for _, a := range tt.adds {
+				cache.add(NewH265Media(), h265Packet(a.nalType, a.timestamp, a.id), a.timestamp)
+			}
+			if got := cachedIDs(cache.snapshot()); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("cached %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 缓存按包计算大小，短包和 reset 之后的状态
+func TestGOPCacheSizeAndReset(t *testing.T) {
+	var cache gopCache
+	cache.configure(true, 0)
+	if cache.maxBytes != defaultGOPCacheBytes {
+		t.Fatalf("maxBytes = %d, want default", cache.maxBytes)
+	}
+
+	cache.add(nil, []byte{0x80, 96}, 3000)
+	cache.add(nil, h265Packet(19, 3000, 1), 3000)
+	cache.add(nil, h265Packet(1, 6000, 2), 6000)
+	if cache.size != 32 || len(cache.packets) != 2 {
+		t.Fatalf("size = %d packets = %d", cache.size, len(cache.packets))
+	}
+
+	snapshot := cache.snapshot()
+	cache.reset()
+	if cache.snapshot() != nil || cache.size != 0 {
+		t.Fatal("cache not empty after reset")
+	}
+	if len(snapshot) != 2 {
+		t.Fatal("snapshot changed by reset")
+	}
+	// reset 之后要重新等关键帧
+	cache.add(nil, h265Packet(1, 9000, 3), 9000)
+	if cache.snapshot() != nil {
+		t.Fatal("cached a packet without keyframe after reset")
+	}
+}
+
+// 新的播放端先按顺序收到缓存的 GOP，时间戳压缩到最后一帧之前，之后是直播包
+func TestGOPCachePlayBurst(t *testing.T) {
+	server := newTestServer(t, RTSPServerInitConfig{})
+	server.AddPath("live")
+	server.SetGOPCache("live", true, 0)
+
+	pushes := []struct {
+		nalType   byte
+		timestamp uint32
+		id        byte
+		marker    bool
+	}{
+		{1, 0, 1, true},
+		{19, 3000, 2, false},
+		{19, 3000, 3, true},
+		{1, 6000, 4, true},
+		{1, 9000, 5, false},
+		{1, 9000, 6, true},
+	}
+	for _, p := range pushes {
+		server.PushVideoFrame("live", h265Packet(p.nalType, p.timestamp, p.id), p.timestamp, p.marker)
+	}
+
+	client := newTestClient(t, server)
+	resp := client.request(t, MethodDescribe, "rtsp://host/live", nil)
+	control := "rtsp://host/live/" + sdpControl(resp.body, 0)
+	if resp := client.request(t, MethodSetup, control, map[string]string{"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1"}); resp.status != 200 {
+		t.Fatalf("SETUP status = %d", resp.status)
+	}
+	resp = client.request(t, MethodPlay, control, nil)
+	if resp.status != 200 {
+		t.Fatalf("PLAY status = %d", resp.status)
+	}
+
+	// 缓存里 3 帧，最后一帧保持 9000，前面每帧相差 1
+	var seq uint16
+	var rtptime uint32
+	info := resp.headers["RTP-Info"]
+	for _, field := range strings.Split(info, ";") {
+		if v, ok := strings.CutPrefix(field, "seq="); ok {
+			n, _ := strconv.ParseUint(v, 10, 16)
+			seq = uint16(n)
+		}
+		if v, ok := strings.CutPrefix(field, "rtptime="); ok {
+			n, _ := strconv.ParseUint(v, 10, 32)
+			rtptime = uint32(n)
+		}
+	}
+	if rtptime != 8998 {
+		t.Fatalf("RTP-Info = %q, want rtptime=8998", info)
+	}
+
+	server.PushVideoFrame("live", h265Packet(1, 12000, 7), 12000, true)
+
+	want := []struct {
+		id        byte
+		timestamp uint32
+		marker    bool
+	}{
+		{2, 8998, false},
+		{3, 8998, true},
+		{4, 8999, true},
+		{5, 9000, false},
+		{6, 9000, true},
+		{7, 12000, true},
+	}
+	for i, w := range want {
+		select {
+		case packet := <-client.packets:
+			if id := packet[len(packet)-1]; id != w.id {
+				t.Fatalf("packet %d id = %d, want %d", i, id, w.id)
+			}
+			if got := binary.BigEndian.Uint16(packet[2:4]); got != seq+uint16(i) {
+				t.Errorf("packet %d seq = %d, want %d", i, got, seq+uint16(i))
+			}
+			if got := binary.BigEndian.Uint32(packet[4:8]); got != w.timestamp {
+				t.Errorf("packet %d timestamp = %d, want %d", i, got, w.timestamp)
+			}
+			if marker := packet[1]&0x80 != 0; marker != w.marker {
+				t.Errorf("packet %d marker = %v", i, marker)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for packet %d", i)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+// streamHub 一个流路径上正在播放的 session 列表，
+// 推流只遍历本路径的订阅者，和其他流互不影响
+type streamHub struct {
+	path        string
+	track       int
+	subscribers map[string]*StreamSession
+	media       *MediaDescription
+	// 上一次请求关键帧的时间(UnixNano)，用于限频
+	lastKeyframeRequest atomic.Int64
+	// 最近推送的包的 SSRC，DESCRIBE 时写进 SDP 和 RTX 的 SSRC 关联
+	ssrc         atomic.Uint32
+	fecGroupSize int // 0 为不发送 FEC
+	multicast    *multicastGroup
+	gop          gopCache
+	gopMu        sync.Mutex // push 在 mu 读锁下修改 gop，需要单独的锁
+	mu           sync.RWMutex
+}
+
+func newStreamHub(path string) *streamHub {
+	return &streamHub{
+		path:        path,
+		subscribers: make(map[string]*StreamSession),
+	}
+}
+
+// play 订阅并开始播放，返回 RTP-Info 的 seq 和 rtptime，第一个发出的包还不知道时 ok 为 false。
+// 持有写锁时没有 push 在进行，GOP 缓存的内容和之后的直播包不会重复也不会遗漏
+func (h *streamHub) play(session *StreamSession) (seq uint16, rtptime uint32, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if group := session.multicastGroup(); group != nil {
+		// 组播的成员共用一个序号，不发 GOP 缓存，从组的下一个包开始
+		group.mu.Lock()
+		seq := group.sequence
+		session.resume(nil)
+		group.mu.Unlock()
+		return seq, 0, false
+	}
+
+	h.gopMu.Lock()
+	burst := h.gop.snapshot()
+	h.gopMu.Unlock()
+
+	session.configureFEC(h.fecGroupSize)
+	seq, rtptime, ok = session.resume(burst)
+	h.subscribers[session.SessionID] = session
+	return seq, rtptime, ok
+}
+
+func (h *streamHub) fecLevel() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.fecGroupSize
+}
+
+// setFECLevel 修改 FEC 保护，正在播放的客户端立即生效
+func (h *streamHub) setFECLevel(groupSize int) {
+	if groupSize < 0 {
+		groupSize = 0
+	}
+	if groupSize > rtp.MaxULPFECGroupSize {
+		groupSize = rtp.MaxULPFECGroupSize
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fecGroupSize = groupSize
+	for _, session := range h.subscribers {
+		session.configureFEC(groupSize)
+	}
+}
+
+func (h *streamHub) setMedia(media *MediaDescription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.media = media
+	h.gopMu.Lock()
+	h.gop.reset()
+	h.gopMu.Unlock()
+}
+
+func (h *streamHub) configureGOPCache(enabled bool, maxBytes int) {
+	h.gopMu.Lock()
+	defer h.gopMu.Unlock()
+	h.gop.configure(enabled, maxBytes)
+}
+
+func (h *streamHub) unsubscribe(session *StreamSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, session.SessionID)
+	h.leaveMulticast(session)
+}
+
+func (h *streamHub) push(data []byte, timestamp uint32, marker bool) {
+	// Marker 位以参数为准，和包里的不一致时改一份副本，不动调用者的数据
+	if len(data) >= 12 && (data[1]&0x80 != 0) != marker {
+		data = append([]byte(nil), data...)
+		if marker {
+			data[1] |= 0x80
+		} else {
+			data[1] &= 0x7F
+		}
+	}
+
+	if len(data) >= 12 {
+		h.ssrc.Store(binary.BigEndian.Uint32(data[8:12]))
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.gopMu.Lock()
+	h.gop.add(h.media, data, timestamp)
+	h.gopMu.Unlock()
+
+	for _, session := range h.subscribers {
+		playing, closeConn := session.pushState()
+		if !playing {
+			continue
+		}
+		session.SendRTPPacket(data, timestamp, marker)
+		if closeConn != nil {
+			utils.Info("session %s close", session.SessionID)
+			closeConn.Close()
+		}
+	}
+	if h.multicast != nil {
+		h.multicast.send(h.media, data)
+	}
+}
+
+// hubKey 按路径和轨道序号区分 hub
+type hubKey struct {
+	path  string
+	track int
+}
+
+// getHub 返回路径第一个轨道的 hub，路径没有注册时返回 nil
+func (s *RTSPServer) getHub(path string) *streamHub {
+	return s.trackHub(path, 0)
+}
+
+// trackHub 返回路径上某个轨道的 hub，每个轨道单独分发。
+// hub 只在 AddPath/ANNOUNCE 时按轨道创建，路径或轨道不存在时返回 nil
+func (s *RTSPServer) trackHub(path string, track int) *streamHub {
+	s.hubMu.RLock()
+	defer s.hubMu.RUnlock()
+	return s.hubs[hubKey{path, track}]
+}
+
+// ensureHub 返回轨道的 hub，不存在时创建，调用者持有 s.mu
+func (s *RTSPServer) ensureHub(path string, track int) *streamHub {
+	s.hubMu.Lock()
+	defer s.hubMu.Unlock()
+	key := hubKey{path, track}
+	hub, ok := s.hubs[key]
+	if !ok {
+		hub = newStreamHub(path)
+		hub.track = track
+		s.hubs[key] = hub
+	}
+	return hub
+}
+
+// pathHubs 返回路径上已经创建的所有轨道的 hub
+func (s *RTSPServer) pathHubs(path string) []*streamHub {
+	s.hubMu.RLock()
+	defer s.hubMu.RUnlock()
+
+	var hubs []*streamHub
+	for key, hub := range s.hubs {
+		if key.path == path {
+			hubs = append(hubs, hub)
+		}
+	}
+	return hubs
+}
+
+// removeHubs 路径删除时去掉它的 hub 并关闭组播组，调用者持有 s.mu
+func (s *RTSPServer) removeHubs(path string) {
+	s.hubMu.Lock()
+	var hubs []*streamHub
+	for key, hub := range s.hubs {
+		if key.path == path {
+			hubs = append(hubs, hub)
+			delete(s.hubs, key)
+		}
+	}
+	s.hubMu.Unlock()
+
+	for _, hub := range hubs {
+		hub.mu.Lock()
+		if hub.multicast != nil {
+			hub.multicast.close()
+			hub.multicast = nil
+		}
+		hub.mu.Unlock()
+	}
+}
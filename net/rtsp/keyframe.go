@@ -0,0 +1,83 @@
+package rtsp
+
+import (
+	"time"
+
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+// KeyframeRequestReason 请求关键帧的原因
+type KeyframeRequestReason int
+
+const (
+	KeyframeRequestPLI        KeyframeRequestReason = iota // 0: 客户端发送 RTCP PLI
+	KeyframeRequestFIR                                     // 1: 客户端发送 RTCP FIR
+	KeyframeRequestNewViewer                               // 2: 新的客户端开始 PLAY
+	KeyframeRequestPacketLoss                              // 3: 客户端 RR 报告的丢包率超过阈值
+)
+
+func (r KeyframeRequestReason) String() string {
+	switch r {
+	case KeyframeRequestPLI:
+		return "pli"
+	case KeyframeRequestFIR:
+		return "fir"
+	case KeyframeRequestNewViewer:
+		return "new_viewer"
+	case KeyframeRequestPacketLoss:
+		return "packet_loss"
+	}
+	return "unknown"
+}
+
+const (
+	defaultKeyframeRequestInterval = 1000
+	defaultKeyframeLossThreshold   = 10
+)
+
+// SetKeyframeRequestHandler 设置请求关键帧的回调，编码器收到后尽快出一个 IDR。
+// 每个流按 KeyframeRequestInterval 限频，回调在连接或 RTCP 的 goroutine 中执行，不要阻塞
+func (s *RTSPServer) SetKeyframeRequestHandler(handler func(streamPath string, reason KeyframeRequestReason)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyframeHandler = handler
+}
+
+// requestKeyframe 按流限频后调用回调
+func (s *RTSPServer) requestKeyframe(streamPath string, reason KeyframeRequestReason) {
+	s.mu.RLock()
+	handler := s.keyframeHandler
+	s.mu.RUnlock()
+	if handler == nil {
+		return
+	}
+
+	hub := s.getHub(streamPath)
+	if hub == nil || !hub.allowKeyframeRequest(s.keyframeInterval) {
+		return
+	}
+	utils.Info("Request keyframe for %s: %s", streamPath, reason)
+	handler(streamPath, reason)
+}
+
+// handleKeyframeRequest session 收到 PLI/FIR 或丢包超过阈值
+func (s *RTSPServer) handleKeyframeRequest(session *StreamSession, reason KeyframeRequestReason) {
+	if session.publishing {
+		return
+	}
+	s.requestKeyframe(session.StreamPath, reason)
+}
+
+// allowKeyframeRequest 距离上一次请求超过 interval 时返回 true 并记录本次时间
+func (h *streamHub) allowKeyframeRequest(interval time.Duration) bool {
+	now := time.Now().UnixNano()
+	for {
+		last := h.lastKeyframeRequest.Load()
+		if last != 0 && now-last < int64(interval) {
+			return false
+		}
+		if h.lastKeyframeRequest.CompareAndSwap(last, now) {
+			return true
+		}
+	}
+}
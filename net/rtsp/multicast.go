@@ -0,0 +1,249 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/tthhr/go_rtsp/net/transport"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+const (
+	defaultMulticastAddress = "239.255.0.1"
+	defaultMulticastPortMin = 40000
+	defaultMulticastPortMax = 40999
+	defaultMulticastTTL     = 16
+)
+
+// multicastGroup 一个流的组播组，不管有多少个客户端每个包只发一次
+type multicastGroup struct {
+	allocator *multicastAllocator
+	index     int // 在 allocator 中的序号，组关闭时归还
+	address   net.IP
+	port      int // RTP 端口，RTCP 为 port+1
+	ttl       int
+	sender    *transport.UDPServer
+	rtcp      *transport.UDPServer // 接收成员发到 port+1 的 RTCP
+	members   map[string]*StreamSession
+
+	sequence     uint16
+	waitKeyframe bool
+	mu           sync.Mutex
+}
+
+func (g *multicastGroup) transport() string {
+	return fmt.Sprintf("RTP/AVP;multicast;destination=%s;port=%d-%d;ttl=%d", g.address, g.port, g.port+1, g.ttl)
+}
+
+// playing 是否有成员在播放，调用者持有 g.mu，成员的状态在它自己的锁下读取
+func (g *multicastGroup) playing() bool {
+	for _, member := range g.members {
+		if playing, _ := member.pushState(); playing {
+			return true
+		}
+	}
+	return false
+}
+
+// send 按组重写序号后发到组播地址，和单播一样从关键帧开始发送
+func (g *multicastGroup) send(media *MediaDescription, data []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(data) < 12 || !g.playing() {
+		g.waitKeyframe = true
+		return
+	}
+	if g.waitKeyframe {
+		if !keyframeStart(media, data[12:]) {
+			return
+		}
+		g.waitKeyframe = false
+	}
+
+	packet := make([]byte, len(data))
+	copy(packet, data)
+	binary.BigEndian.PutUint16(packet[2:4], g.sequence)
+	g.sequence++
+
+	if err := g.sender.WriteTo(packet, &net.UDPAddr{IP: g.address, Port: g.port}); err != nil {
+		utils.Debug("multicast %s:%d send error: %s", g.address, g.port, err.Error())
+	}
+}
+
+// readRTCP 接收成员发到组播 RTCP 端口的报告，按来源 IP 刷新对应成员的活动时间，
+// 不然组播客户端只发 RTCP 不发 RTSP 请求时会被超时回收。组关闭后退出
+func (g *multicastGroup) readRTCP() {
+	buffer := make([]byte, 1500)
+	for {
+		n, addr, err := g.rtcp.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if n < 8 {
+			continue
+		}
+		// 复制一份成员后释放 g.mu 再刷新活动时间，不阻塞组播发送
+		g.mu.Lock()
+		members := make([]*StreamSession, 0, len(g.members))
+		for _, member := range g.members {
+			members = append(members, member)
+		}
+		g.mu.Unlock()
+
+		for _, member := range members {
+			conn := member.rtspConn()
+			if conn == nil {
+				continue
+			}
+			if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok && remote.IP.Equal(addr.IP) {
+				member.UpdateActivity()
+			}
+		}
+	}
+}
+
+// close 关闭 socket 并归还地址和端口
+func (g *multicastGroup) close() {
+	g.sender.Close()
+	g.rtcp.Close()
+	g.allocator.release(g.index)
+}
+
+// multicastAllocator 按流分配组播地址和端口对: 第 i 个组使用起始地址+i 和第 i 个端口对，
+// 组关闭后序号归还，同时存在的组不超过端口对的数量
+type multicastAllocator struct {
+	base    net.IP
+	portMin int
+	portMax int
+	ttl     int
+	used    []bool
+	mu      sync.Mutex
+}
+
+func newMulticastAllocator(address string, portMin, portMax, ttl int) (*multicastAllocator, error) {
+	if address == "" {
+		address = defaultMulticastAddress
+	}
+	base := net.ParseIP(address).To4()
+	if base == nil || !base.IsMulticast() {
+		return nil, fmt.Errorf("invalid multicast address %s", address)
+	}
+	if portMin <= 0 {
+		portMin = defaultMulticastPortMin
+	}
+	if portMax <= 0 {
+		portMax = defaultMulticastPortMax
+	}
+	// RTP 使用偶数端口
+	portMin += portMin % 2
+	if portMax < portMin+1 {
+		return nil, fmt.Errorf("invalid multicast port range %d-%d", portMin, portMax)
+	}
+	if ttl <= 0 {
+		ttl = defaultMulticastTTL
+	}
+	// 地址不能超出 224.0.0.0/4
+	groups := (portMax - portMin + 1) / 2
+	if remaining := int(0xEFFFFFFF - binary.BigEndian.Uint32(base) + 1); remaining < groups {
+		groups = remaining
+	}
+	return &multicastAllocator{base: base, portMin: portMin, portMax: portMax, ttl: ttl, used: make([]bool, groups)}, nil
+}
+
+func (a *multicastAllocator) allocate() (*multicastGroup, error) {
+	a.mu.Lock()
+	index := -1
+	for i, used := range a.used {
+		if !used {
+			index = i
+			a.used[i] = true
+			break
+		}
+	}
+	a.mu.Unlock()
+	if index < 0 {
+		return nil, fmt.Errorf("no free multicast group, %d in use", len(a.used))
+	}
+
+	address := make(net.IP, 4)
+	binary.BigEndian.PutUint32(address, binary.BigEndian.Uint32(a.base)+uint32(index))
+	port := a.portMin + 2*index
+
+	sender, err := transport.NewMulticastSender(a.ttl)
+	if err != nil {
+		a.release(index)
+		return nil, err
+	}
+	rtcp, err := transport.NewMulticastReceiver(address, port+1)
+	if err != nil {
+		sender.Close()
+		a.release(index)
+		return nil, err
+	}
+	group := &multicastGroup{
+		allocator: a,
+		index:     index,
+		address:   address,
+		port:      port,
+		ttl:       a.ttl,
+		sender:    sender,
+		rtcp:      rtcp,
+		members:   make(map[string]*StreamSession),
+
+		sequence:     1,
+		waitKeyframe: true,
+	}
+	go group.readRTCP()
+	return group, nil
+}
+
+func (a *multicastAllocator) release(index int) {
+	a.mu.Lock()
+	a.used[index] = false
+	a.mu.Unlock()
+}
+
+// joinMulticast 加入流的组播组，第一个成员加入时分配组
+func (h *streamHub) joinMulticast(session *StreamSession, allocator *multicastAllocator) (*multicastGroup, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.multicast == nil {
+		group, err := allocator.allocate()
+		if err != nil {
+			return nil, err
+		}
+		utils.Info("Multicast group for %s: %s:%d", h.path, group.address, group.port)
+		h.multicast = group
+	}
+	group := h.multicast
+	group.mu.Lock()
+	group.members[session.SessionID] = session
+	group.mu.Unlock()
+
+	session.mu.Lock()
+	session.multicast = group
+	session.mu.Unlock()
+	return group, nil
+}
+
+// leaveMulticast 离开组播组，最后一个成员离开时关闭组并归还地址，调用者持有 h.mu
+func (h *streamHub) leaveMulticast(session *StreamSession) {
+	group := h.multicast
+	if group == nil {
+		return
+	}
+	group.mu.Lock()
+	delete(group.members, session.SessionID)
+	empty := len(group.members) == 0
+	group.mu.Unlock()
+
+	if empty {
+		utils.Info("Multicast group for %s closed", h.path)
+		group.close()
+		h.multicast = nil
+	}
+}
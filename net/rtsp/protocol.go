@@ -2,6 +2,7 @@ package rtsp
 
 import (
 	"fmt"
+	"net/textproto"
 	"strconv"
 	"strings"
 )
@@ -14,19 +15,27 @@ const (
 	MethodTeardown = "TEARDOWN"
 	MethodAnnounce = "ANNOUNCE"
 	MethodRecord   = "RECORD"
+	MethodPause    = "PAUSE"
+
+	MethodGetParameter = "GET_PARAMETER"
+	MethodSetParameter = "SET_PARAMETER"
 )
 
 type RTSPRequest struct {
 	Method    string
 	URL       string
 	Version   string
-	Headers   map[string]string
+	Headers   map[string]string // 头名已规范化，重复的头用 ", " 连接
 	Session   string
 	Sequence  int
 	Transport string
 	Require   string
 	UserAgent string
 	Body      string
+	// 每个头的所有取值，按出现顺序
+	HeaderValues map[string][]string
+
+	raw string // 原始请求文本，打印协议日志用
 }
 
 type RTSPResponse struct {
@@ -37,55 +46,103 @@ type RTSPResponse struct {
 	Body       string
 }
 
+// 不符合 MIME 规范化写法的 RTSP 头
+var rtspHeaderNames = map[string]string{
+	"cseq":             "CSeq",
+	"www-authenticate": "WWW-Authenticate",
+	"rtp-info":         "RTP-Info",
+	"content-base":     "Content-Base",
+}
+
+// CanonicalHeaderKey 头名大小写不敏感，统一成 "Content-Length"、"CSeq" 的写法
+func CanonicalHeaderKey(key string) string {
+	if name, ok := rtspHeaderNames[strings.ToLower(key)]; ok {
+		return name
+	}
+	return textproto.CanonicalMIMEHeaderKey(key)
+}
+
+// Header 大小写不敏感地取头的值
+func (r *RTSPRequest) Header(key string) string {
+	return r.Headers[CanonicalHeaderKey(key)]
+}
+
+// ParseRTSPRequest 解析一条完整的请求文本(包括 body)
 func ParseRTSPRequest(data string) *RTSPRequest {
-	lines := strings.Split(data, "\r\n")
-	if len(lines) < 1 {
-		return nil
+	head, body, _ := strings.Cut(data, "\r\n\r\n")
+	var lines []string
+	for _, line := range strings.Split(head, "\r\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
 	}
 
-	// Parse request line
-	parts := strings.Split(lines[0], " ")
-	if len(parts) < 3 {
+	req, err := parseRequestLines(lines)
+	if err != nil || req.Method == "" {
 		return nil
 	}
+	req.Body = body
+	req.raw = data
+	return req
+}
+
+// parseRequestLines 解析起始行和头部。起始行是 "RTSP/1.0 ..." 时是一个响应，Method 为空
+func parseRequestLines(lines []string) (*RTSPRequest, error) {
+	if len(lines) < 1 {
+		return nil, fmt.Errorf("empty rtsp message")
+	}
 
 	req := &RTSPRequest{
-		Method:  parts[0],
-		URL:     parts[1],
-		Version: parts[2],
-		Headers: make(map[string]string),
+		Headers:      make(map[string]string),
+		HeaderValues: make(map[string][]string),
+	}
+
+	// Parse request line
+	parts := strings.Fields(lines[0])
+	if len(parts) > 0 && strings.HasPrefix(parts[0], "RTSP/") {
+		// 响应，只解析头部
+	} else if len(parts) >= 3 {
+		req.Method = parts[0]
+		req.URL = parts[1]
+		req.Version = parts[2]
+	} else {
+		return nil, fmt.Errorf("invalid request line: %q", lines[0])
 	}
+
 	idx := strings.Index(req.URL, "streamid=")
 	if idx != -1 {
+		// 多轨道的 control 是 streamid=<session>/trackID=N
 		req.Session = req.URL[idx+len("streamid="):]
+		if slash := strings.Index(req.Session, "/"); slash != -1 {
+			req.Session = req.Session[:slash]
+		}
 	}
 
 	// Parse headers
-	for i := 1; i < len(lines); i++ {
-		line := lines[i]
-		if line == "" {
-			break
+	for _, line := range lines[1:] {
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
 		}
+		key := CanonicalHeaderKey(strings.TrimSpace(line[:idx]))
+		value := strings.TrimSpace(line[idx+1:])
 
-		if idx := strings.Index(line, ":"); idx > 0 {
-			key := strings.TrimSpace(line[:idx])
-			value := strings.TrimSpace(line[idx+1:])
+		req.HeaderValues[key] = append(req.HeaderValues[key], value)
+		if prev, ok := req.Headers[key]; ok {
+			req.Headers[key] = prev + ", " + value
+		} else {
 			req.Headers[key] = value
-
-			switch key {
-			case "CSeq":
-				// Parse sequence number
-			case "Transport":
-				req.Transport = value
-			case "Require":
-				req.Require = value
-			case "User-Agent":
-				req.UserAgent = value
-			}
 		}
 	}
 
-	return req
+	if cseq, err := strconv.Atoi(req.Headers["CSeq"]); err == nil {
+		req.Sequence = cseq
+	}
+	req.Transport = req.Headers["Transport"]
+	req.Require = req.Headers["Require"]
+	req.UserAgent = req.Headers["User-Agent"]
+
+	return req, nil
 }
 
 func BuildRTSPResponse(statusCode int, statusText string, headers map[string]string, body string) string {
@@ -109,3 +166,36 @@ func BuildRTSPResponse(statusCode int, statusText string, headers map[string]str
 
 	return response
 }
+
+// ParseTextParameters 解析 text/parameters 格式的 body，
+// 每行一个参数，GET_PARAMETER 只有名字，SET_PARAMETER 是 "name: value"
+func ParseTextParameters(body string) ([]string, map[string]string) {
+	var names []string
+	params := make(map[string]string)
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if idx := strings.Index(line, ":"); idx > 0 {
+			name := strings.TrimSpace(line[:idx])
+			names = append(names, name)
+			params[name] = strings.TrimSpace(line[idx+1:])
+		} else {
+			names = append(names, line)
+		}
+	}
+	return names, params
+}
+
+// BuildTextParameters 按 names 的顺序生成 text/parameters 格式的 body
+func BuildTextParameters(names []string, params map[string]string) string {
+	var builder strings.Builder
+	for _, name := range names {
+		if value, ok := params[name]; ok {
+			builder.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,142 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+// handleAnnounce 推流端(摄像机、ffmpeg -f rtsp)通过 ANNOUNCE 上报 SDP，
+// 创建推流 session，之后的 SETUP/RECORD 都作用在这个 session 上
+func (s *RTSPServer) handleAnnounce(req *RTSPRequest, cseq int) (string, *StreamSession) {
+	headers := map[string]string{
+		"CSeq":   fmt.Sprintf("%d", cseq),
+		"Server": s.serverName,
+	}
+
+	if contentType := req.Header("Content-Type"); contentType != "" && contentType != "application/sdp" {
+		return BuildRTSPResponse(415, "Unsupported Media Type", headers, ""), nil
+	}
+	desc, err := ParseSDP(req.Body)
+	if err != nil {
+		utils.Warn("ANNOUNCE invalid sdp: %s", err.Error())
+		return BuildRTSPResponse(400, "Bad Request", headers, ""), nil
+	}
+	// 每个 m= 是一个轨道，按 SDP 中的顺序编号
+	if len(desc.Medias) == 0 {
+		return BuildRTSPResponse(415, "Unsupported Media Type", headers, ""), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streamPath := extractStreamPath(req.URL)
+	path, ok := s.availablePaths[streamPath]
+	if (!ok || path == "") && !s.publishAutoCreate {
+		utils.Warn("Publish to unknown stream: %s", streamPath)
+		return BuildRTSPResponse(404, "Not Found", headers, ""), nil
+	}
+	if _, busy := s.publishers[streamPath]; busy {
+		utils.Warn("Stream %s already has a publisher", streamPath)
+		return BuildRTSPResponse(455, "Method Not Valid in This State", headers, ""), nil
+	}
+	if !ok || path == "" {
+		s.availablePaths[streamPath] = streamPath
+		s.autoPaths[streamPath] = true
+		utils.Info("Stream auto created by publisher: %s", streamPath)
+	}
+
+	session := s.newSession(streamPath)
+	session.publishing = true
+	session.Media = desc.Medias[0]
+	session.trackMedia = desc.Medias
+	session.State = "announced"
+
+	s.sessions[session.SessionID] = session
+	s.publishers[streamPath] = session
+	s.setHubMedia(streamPath, desc.Medias)
+	for _, media := range desc.Medias {
+		utils.Info("Publisher %s announced %s/%d on %s", session.SessionID, media.Encoding, media.ClockRate, streamPath)
+	}
+
+	return BuildRTSPResponse(200, "OK", headers, ""), session
+}
+
+func (s *RTSPServer) handleRecord(req *RTSPRequest, cseq int, session *StreamSession) string {
+	if session == nil {
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(454, "Session Not Found", headers, "")
+	}
+	if !session.publishing {
+		headers := map[string]string{
+			"CSeq":    fmt.Sprintf("%d", cseq),
+			"Session": session.SessionID,
+			"Server":  s.serverName,
+		}
+		return BuildRTSPResponse(455, "Method Not Valid in This State", headers, "")
+	}
+
+	for _, track := range session.trackSessions() {
+		track.setState("recording")
+		if !track.isTcp {
+			track := track
+			track.StartIngest(func(packet []byte) {
+				s.ingestRTP(track, packet)
+			})
+		}
+	}
+	session.setState("recording")
+	session.UpdateActivity()
+	s.emitEvent(EventPublishStart, session)
+
+	headers := map[string]string{
+		"CSeq":    fmt.Sprintf("%d", cseq),
+		"Session": session.SessionID,
+		"Server":  s.serverName,
+	}
+
+	return BuildRTSPResponse(200, "OK", headers, "")
+}
+
+// ingestRTP 把推流端的 RTP 包转发给同一路径上的播放端，
+// 和 ServerAPI.PushVideoStream 推进来的包走同一条路
+func (s *RTSPServer) ingestRTP(session *StreamSession, packet []byte) {
+	session.UpdateActivity()
+	if !session.recording() {
+		return
+	}
+
+	header, payload, err := rtp.ParseRTPPacket(packet)
+	if err != nil {
+		utils.Debug("Publisher %s: %s", session.SessionID, err.Error())
+		return
+	}
+	// 去掉 CSRC/扩展头，播放端按 12 字节固定头处理
+	normalized := rtp.BuildRTPPacket(header, payload)
+	s.PushTrackPacket(session.StreamPath, session.Track, normalized, header.Timestamp, header.Marker)
+}
+
+// removePublisher 在推流 session 删除时调用，调用者持有 s.mu
+func (s *RTSPServer) removePublisher(session *StreamSession) {
+	path := session.StreamPath
+	if s.publishers[path] != session {
+		return
+	}
+	delete(s.publishers, path)
+	if s.autoPaths[path] {
+		delete(s.autoPaths, path)
+		s.availablePaths[path] = ""
+		utils.Info("Stream auto removed: %s", path)
+	}
+	if s.availablePaths[path] == "" {
+		// 推流期间路径被删除或者是自动创建的
+		s.removeHubs(path)
+	} else {
+		s.setHubMedia(path, s.pathMedia[path])
+	}
+	go s.emitEvent(EventPublishStop, session)
+}
@@ -0,0 +1,160 @@
+package rtsp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMaxHeaderBytes = 16 * 1024
+	defaultMaxBodyBytes   = 1024 * 1024
+)
+
+var (
+	ErrHeaderTooLarge = errors.New("rtsp header too large")
+	ErrBodyTooLarge   = errors.New("rtsp body too large")
+)
+
+// InterleavedFrame 客户端在 RTSP 连接上发来的 '$' 帧(RFC 2326 10.12)，
+// 比如 TCP 模式下的 RTCP 接收报告
+type InterleavedFrame struct {
+	Channel int
+	Data    []byte
+}
+
+// RTSPReader 增量读取 RTSP/1.0 请求，按 Content-Length 读 body，
+// 同一连接上的 '$' 帧单独返回
+type RTSPReader struct {
+	reader         *bufio.Reader
+	MaxHeaderBytes int
+	MaxBodyBytes   int
+}
+
+func NewRTSPReader(r io.Reader) *RTSPReader {
+	reader, ok := r.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(r)
+	}
+	return &RTSPReader{
+		reader:         reader,
+		MaxHeaderBytes: defaultMaxHeaderBytes,
+		MaxBodyBytes:   defaultMaxBodyBytes,
+	}
+}
+
+// ReadMessage 读取下一条消息，返回请求或者 interleaved 帧其中之一。
+// 客户端发来的 RTSP 响应会被跳过
+func (r *RTSPReader) ReadMessage() (*RTSPRequest, *InterleavedFrame, error) {
+	for {
+		first, err := r.reader.Peek(1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if first[0] == '$' {
+			frame, err := r.readInterleaved()
+			return nil, frame, err
+		}
+
+		lines, err := r.readHeaderLines()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(lines) == 0 {
+			// 消息之间多余的空行
+			continue
+		}
+
+		req, err := parseRequestLines(lines)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := r.readBody(req); err != nil {
+			return nil, nil, err
+		}
+		req.raw = strings.Join(lines, "\r\n") + "\r\n\r\n" + req.Body
+		if req.Method == "" {
+			// 客户端对服务端请求的响应，目前不需要处理
+			continue
+		}
+		return req, nil, nil
+	}
+}
+
+func (r *RTSPReader) readInterleaved() (*InterleavedFrame, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return nil, err
+	}
+	length := int(header[2])<<8 | int(header[3])
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return nil, err
+	}
+	return &InterleavedFrame{Channel: int(header[1]), Data: data}, nil
+}
+
+// readHeaderLines 读取起始行和头部直到空行，去掉行尾的 CRLF
+func (r *RTSPReader) readHeaderLines() ([]string, error) {
+	var lines []string
+	total := 0
+	for {
+		line, err := r.readLine(&total)
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return lines, nil
+		}
+		// 头部折行(以空白开头)接到上一行
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 1 {
+			lines[len(lines)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		lines = append(lines, line)
+	}
+}
+
+// readLine 按缓冲区大小分段读取一行，累计的头部长度超过 MaxHeaderBytes 就停止，
+// 不会因为一直不发换行而无限缓存
+func (r *RTSPReader) readLine(total *int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		*total += len(chunk)
+		if *total > r.MaxHeaderBytes {
+			return "", ErrHeaderTooLarge
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return string(line), err
+	}
+}
+
+func (r *RTSPReader) readBody(req *RTSPRequest) error {
+	lengthStr, ok := req.Headers["Content-Length"]
+	if !ok {
+		return nil
+	}
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil || length < 0 {
+		return fmt.Errorf("invalid Content-Length: %s", lengthStr)
+	}
+	if length > r.MaxBodyBytes {
+		return ErrBodyTooLarge
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, body); err != nil {
+		return err
+	}
+	req.Body = string(body)
+	return nil
+}
@@ -0,0 +1,270 @@
+package rtsp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRTSPReaderReadMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxHeader int
+		maxBody   int
+		method    string
+		cseq      int
+		body      string
+		channel   int // 期望读到 interleaved 帧时的通道，-1 表示期望请求
+		wantErr   error
+		anyErr    bool
+	}{
+		{
+			name:    "options",
+			input:   "OPTIONS rtsp://host/live RTSP/1.0\r\nCSeq: 1\r\n\r\n",
+			method:  MethodOptions,
+			cseq:    1,
+			channel: -1,
+		},
+		{
+			name:    "body by content length",
+			input:   "ANNOUNCE rtsp://host/live RTSP/1.0\r\nCSeq: 2\r\nContent-Length: 5\r\n\r\nv=0\r\nextra",
+			method:  MethodAnnounce,
+			cseq:    2,
+			body:    "v=0\r\n",
+			channel: -1,
+		},
+		{
+			name:    "lower case header",
+			input:   "OPTIONS * RTSP/1.0\r\ncseq: 7\r\ncontent-length: 2\r\n\r\nok",
+			method:  MethodOptions,
+			cseq:    7,
+			body:    "ok",
+			channel: -1,
+		},
+		{
+			name:    "leading blank lines",
+			input:   "\r\n\r\nPLAY rtsp://host/live RTSP/1.0\r\nCSeq: 3\r\n\r\n",
+			method:  MethodPlay,
+			cseq:    3,
+			channel: -1,
+		},
+		{
+			name:    "client response skipped",
+			input:   "RTSP/1.0 200 OK\r\nCSeq: 9\r\nContent-Length: 2\r\n\r\nhiTEARDOWN rtsp://host/live RTSP/1.0\r\nCSeq: 4\r\n\r\n",
+			method:  MethodTeardown,
+			cseq:    4,
+			channel: -1,
+		},
+		{
+			name:    "interleaved frame",
+			input:   "$\x01\x00\x03abc",
+			channel: 1,
+		},
+		{
+			name:    "empty input",
+			input:   "",
+			wantErr: io.EOF,
+		},
+		{
+			name:      "header too large",
+			input:     "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\nX-Pad: " + strings.Repeat("a", 100) + "\r\n\r\n",
+			maxHeader: 64,
+			wantErr:   ErrHeaderTooLarge,
+		},
+		{
+			name:    "body too large",
+			input:   "ANNOUNCE rtsp://host/live RTSP/1.0\r\nCSeq: 1\r\nContent-Length: 11\r\n\r\n0123456789a",
+			maxBody: 10,
+			wantErr: ErrBodyTooLarge,
+		},
+		{
+			name:   "negative content length",
+			input:  "ANNOUNCE rtsp://host/live RTSP/1.0\r\nCSeq: 1\r\nContent-Length: -1\r\n\r\n",
+			anyErr: true,
+		},
+		{
+			name:   "invalid content length",
+			input:  "ANNOUNCE rtsp://host/live RTSP/1.0\r\nCSeq: 1\r\nContent-Length: abc\r\n\r\n",
+			anyErr: true,
+		},
+		{
+			name:    "truncated body",
+			input:   "ANNOUNCE rtsp://host/live RTSP/1.0\r\nCSeq: 1\r\nContent-Length: 10\r\n\r\nv=0",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "truncated header",
+			input:  "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\n",
+			anyErr: true,
+		},
+		{
+			name:    "truncated interleaved frame",
+			input:   "$\x00\x00\x10abc",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "invalid request line",
+			input:  "GARBAGE\r\n\r\n",
+			anyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewRTSPReader(strings.NewReader(tt.input))
+			if tt.maxHeader > 0 {
+				reader.MaxHeaderBytes = tt.maxHeader
+			}
+			if tt.maxBody > 0 {
+				reader.MaxBodyBytes = tt.maxBody
+			}
+
+			req, frame, err := reader.ReadMessage()
+			if tt.wantErr != nil || tt.anyErr {
+				if err == nil {
+					t.Fatalf("expected error, got request %+v frame %+v", req, frame)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.channel >= 0 {
+				if frame == nil || frame.Channel != tt.channel {
+					t.Fatalf("frame = %+v, want channel %d", frame, tt.channel)
+				}
+				return
+			}
+			if req == nil {
+				t.Fatal("expected request")
+			}
+			if req.Method != tt.method || req.Sequence != tt.cseq || req.Body != tt.body {
+				t.Fatalf("got %s cseq=%d body=%q, want %s cseq=%d body=%q",
+					req.Method, req.Sequence, req.Body, tt.method, tt.cseq, tt.body)
+			}
+		})
+	}
+}
+
+// 对端一直发数据但不发换行，读到 MaxHeaderBytes 就要返回，不能等到 EOF
+func TestRTSPReaderHeaderWithoutNewline(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		maxHeader int
+	}{
+		{name: "request line", prefix: "OPTIONS * RTSP/1.0", maxHeader: 64},
+		{name: "header line", prefix: "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\nX-Pad: ", maxHeader: 64},
+		{name: "larger than bufio buffer", prefix: "OPTIONS ", maxHeader: defaultMaxHeaderBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+			defer pr.Close()
+			go func() {
+				if _, err := pw.Write([]byte(tt.prefix)); err != nil {
+					return
+				}
+				spaces := []byte(strings.Repeat(" ", 512))
+				for {
+					if _, err := pw.Write(spaces); err != nil {
+						return
+					}
+				}
+			}()
+
+			reader := NewRTSPReader(pr)
+			reader.MaxHeaderBytes = tt.maxHeader
+			done := make(chan error, 1)
+			go func() {
+				_, _, err := reader.ReadMessage()
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, ErrHeaderTooLarge) {
+					t.Fatalf("error = %v, want %v", err, ErrHeaderTooLarge)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("reader kept buffering past MaxHeaderBytes")
+			}
+		})
+	}
+}
+
+func TestRTSPReaderPipelined(t *testing.T) {
+	input := "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\n\r\n" +
+		"$\x00\x00\x02hi" +
+		"DESCRIBE rtsp://host/live RTSP/1.0\r\nCSeq: 2\r\nX-Long: a\r\n b\r\n\r\n"
+	reader := NewRTSPReader(strings.NewReader(input))
+
+	req, _, err := reader.ReadMessage()
+	if err != nil || req.Method != MethodOptions {
+		t.Fatalf("first message: %+v %v", req, err)
+	}
+	_, frame, err := reader.ReadMessage()
+	if err != nil || frame == nil || string(frame.Data) != "hi" {
+		t.Fatalf("second message: %+v %v", frame, err)
+	}
+	req, _, err = reader.ReadMessage()
+	if err != nil || req.Method != MethodDescribe {
+		t.Fatalf("third message: %+v %v", req, err)
+	}
+	if got := req.Header("x-long"); got != "a b" {
+		t.Fatalf("folded header = %q, want %q", got, "a b")
+	}
+	if _, _, err := reader.ReadMessage(); err != io.EOF {
+		t.Fatalf("after last message err = %v, want EOF", err)
+	}
+}
+
+// 请求超过限制时服务端回 413 并断开连接
+func TestServerRequestTooLarge(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+	}{
+		{
+			name:    "header",
+			request: "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\nX-Pad: " + strings.Repeat("a", defaultMaxHeaderBytes) + "\r\n\r\n",
+		},
+		{
+			name:    "body",
+			request: "ANNOUNCE rtsp://host/live RTSP/1.0\r\nCSeq: 1\r\nContent-Length: 2000000\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewRTSPServer(RTSPServerInitConfig{TcpEnable: true, ServerName: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, conn := net.Pipe()
+			defer client.Close()
+			go server.handleRTSPConnection(conn)
+
+			// net.Pipe 没有缓冲，服务端停止读取后写入会阻塞，单独写
+			go client.Write([]byte(tt.request))
+
+			client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("read response: %v", err)
+			}
+			if !strings.HasPrefix(string(response), "RTSP/1.0 413 ") {
+				t.Fatalf("response = %q, want 413", response)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"math/rand"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+const defaultNACKBufferSize = 512
+
+// retransmitBuffer 最近发出的 RTP 包，按序号取模存放，新包覆盖最旧的包
+type retransmitBuffer struct {
+	packets [][]byte
+}
+
+func newRetransmitBuffer(size int) *retransmitBuffer {
+	if size <= 0 {
+		size = defaultNACKBufferSize
+	}
+	return &retransmitBuffer{packets: make([][]byte, size)}
+}
+
+// put 保存一个已经按 session 重写过序号的包，packet 之后不能再修改
+func (b *retransmitBuffer) put(packet []byte) {
+	seq := binary.BigEndian.Uint16(packet[2:4])
+	b.packets[int(seq)%len(b.packets)] = packet
+}
+
+// get 取出序号对应的包，已经被覆盖时返回 nil
+func (b *retransmitBuffer) get(seq uint16) []byte {
+	packet := b.packets[int(seq)%len(b.packets)]
+	if packet == nil || binary.BigEndian.Uint16(packet[2:4]) != seq {
+		return nil
+	}
+	return packet
+}
+
+// freePayloadType 返回一个没有被 used 占用的动态负载类型，给 RTX/FEC 使用
+func freePayloadType(used ...int) int {
+	for payloadType := 96; payloadType < 127; payloadType++ {
+		free := true
+		for _, u := range used {
+			if u == payloadType {
+				free = false
+				break
+			}
+		}
+		if free {
+			return payloadType
+		}
+	}
+	return 127
+}
+
+// enableRetransmit 开启 NACK 重传，调用者持有 s.mu
+func (s *StreamSession) enableRetransmit(bufferSize int) {
+	s.retransmit = newRetransmitBuffer(bufferSize)
+	s.rtxSequence = uint16(rand.Intn(1 << 16))
+}
+
+// newRTXSSRC 随机分配 RTX 的 SSRC，不能和原始流相同
+func newRTXSSRC(ssrc uint32) uint32 {
+	for {
+		if rtxSSRC := rand.Uint32(); rtxSSRC != 0 && rtxSSRC != ssrc {
+			return rtxSSRC
+		}
+	}
+}
+
+// recordSent 保存发给 UDP 客户端的包，TCP 不会丢包不需要保存，调用者持有 s.mu
+func (s *StreamSession) recordSent(packet []byte) {
+	if s.retransmit != nil && !s.isTcp {
+		s.retransmit.put(packet)
+	}
+}
+
+// resend 按 Generic NACK 重传，SDP 里声明了 RTX 时按 RFC 4588 封装，
+// 使用 SDP 里声明的 RTX SSRC，调用者持有 s.mu
+func (s *StreamSession) resend(seqs []uint16) {
+	if s.retransmit == nil || s.isTcp || s.State != "playing" {
+		return
+	}
+
+	rtxPayload := 0
+	var rtxSSRC uint32
+	if s.Media != nil {
+		rtxPayload = s.Media.RTXPayloadType
+		rtxSSRC = s.Media.RTXSSRC
+	}
+	missing := 0
+	for _, seq := range seqs {
+		packet := s.retransmit.get(seq)
+		if packet == nil {
+			missing++
+			continue
+		}
+		if rtxPayload > 0 {
+			packet = rtp.BuildRTXPacket(packet, uint8(rtxPayload), s.rtxSequence, rtxSSRC)
+			s.rtxSequence++
+		}
+		s.enqueue(outboundPacket{data: packet, repair: true})
+	}
+	if missing > 0 {
+		utils.Debug("Session %s nack %d packets, %d already dropped from buffer", s.SessionID, len(seqs), missing)
+	}
+}
+
+// configureFEC 按流的保护等级创建 ULPFEC 编码器，只给 SDP 里声明了 FEC 的 UDP 客户端发送
+func (s *StreamSession) configureFEC(groupSize int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if groupSize <= 0 || s.isTcp || s.Media == nil || s.Media.FECPayloadType == 0 {
+		s.fec = nil
+		return
+	}
+	s.fec = rtp.NewULPFECEncoder(uint8(s.Media.FECPayloadType), groupSize, rand.Uint32())
+}
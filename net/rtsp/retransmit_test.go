@@ -0,0 +1,118 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+)
+
+// drainSent 取出发送队列里的包，分成媒体包和 FEC 包
+func drainSent(session *StreamSession, fecPayloadType int) (media [][]byte, fec [][]byte) {
+	for {
+		select {
+		case packet := <-session.sendQueue:
+			if int(packet.data[1]&0x7F) == fecPayloadType {
+				fec = append(fec, packet.data)
+			} else {
+				media = append(media, packet.data)
+			}
+		default:
+			return media, fec
+		}
+	}
+}
+
+// 播放中修改 FEC 保护等级，正在播放的 UDP 客户端从下一个包开始按新的组大小生成 FEC
+func TestSetFECLevelMidStream(t *testing.T) {
+	server := newTestServer(t, RTSPServerInitConfig{})
+	server.AddPath("live")
+	server.SetFEC("live", 4)
+
+	client := newTestClient(t, server)
+	resp := client.request(t, MethodDescribe, "rtsp://host/live", nil)
+	if !strings.Contains(resp.body, " ulpfec/90000\r\n") {
+		t.Fatalf("ulpfec not declared:\n%s", resp.body)
+	}
+
+	server.mu.RLock()
+	var session *StreamSession
+	for _, s := range server.sessions {
+		session = s
+	}
+	server.mu.RUnlock()
+	fecPayloadType := session.Media.FECPayloadType
+
+	// 按 UDP 客户端订阅，不启动发送 goroutine，直接从发送队列里取
+	session.mu.Lock()
+	session.isTcp = false
+	session.State = "playing"
+	session.mu.Unlock()
+	hub := server.getHub("live")
+	hub.mu.Lock()
+	hub.subscribers[session.SessionID] = session
+	hub.mu.Unlock()
+	session.configureFEC(hub.fecLevel())
+
+	next := uint16(0)
+	push := func(n int) {
+		for i := 0; i < n; i++ {
+			server.PushVideoFrame("live", h265Packet(1, uint32(next)*3000, byte(next)), uint32(next)*3000, false)
+			next++
+		}
+	}
+
+	steps := []struct {
+		name   string
+		level  int // <0 时不修改
+		pushes int
+		groups []int // 每个 FEC 包保护的包数
+	}{
+		{name: "group of 4", level: -1, pushes: 8, groups: []int{4, 4}},
+		{name: "partial group", level: -1, pushes: 3},
+		{name: "switch to 2 drops partial group", level: 2, pushes: 5, groups: []int{2, 2}},
+		{name: "switch to 3", level: 3, pushes: 1},
+		{name: "group spans pushes", level: -1, pushes: 2, groups: []int{3}},
+		{name: "disabled", level: 0, pushes: 6},
+		{name: "enabled again", level: 2, pushes: 2, groups: []int{2}},
+	}
+
+	for _, step := range steps {
+		if step.level >= 0 {
+			server.SetFEC("live", step.level)
+		}
+		push(step.pushes)
+		media, fec := drainSent(session, fecPayloadType)
+		if len(media) != step.pushes {
+			t.Fatalf("%s: %d media packets, want %d", step.name, len(media), step.pushes)
+		}
+		if len(fec) != len(step.groups) {
+			t.Fatalf("%s: %d fec packets, want %d", step.name, len(fec), len(step.groups))
+		}
+		for i, packet := range fec {
+			mask := binary.BigEndian.Uint16(packet[24:26])
+			protected := 0
+			for ; mask != 0; mask <<= 1 {
+				protected++
+			}
+			if protected != step.groups[i] {
+				t.Fatalf("%s: fec %d protects %d packets, want %d", step.name, i, protected, step.groups[i])
+			}
+		}
+	}
+}
+
+// FEC 等级限制在 0~MaxULPFECGroupSize
+func TestSetFECLevelClamp(t *testing.T) {
+	server := newTestServer(t, RTSPServerInitConfig{})
+	server.AddPath("live")
+	hub := server.getHub("live")
+
+	for _, tt := range []struct{ level, want int }{{4, 4}, {1000, rtp.MaxULPFECGroupSize}, {-1, 0}} {
+		server.SetFEC("live", tt.level)
+		if got := hub.fecLevel(); got != tt.want {
+			t.Errorf("SetFEC(%d): level = %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
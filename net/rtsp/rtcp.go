@@ -0,0 +1,190 @@
+package rtsp
+
+import (
+	"os"
+	"time"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+// ClientStats 播放端通过 RTCP RR 报告的接收质量
+type ClientStats struct {
+	SessionID      string
+	StreamPath     string
+	Track          int // 多轨道时每个轨道一项
+	RemoteAddr     string
+	CNAME          string
+	FractionLost   float64 // 最近一个报告周期的丢包率 0~1
+	CumulativeLost int32
+	Jitter         time.Duration
+	RTT            time.Duration // 客户端的报告带有 LSR 时才有值
+	PacketsSent    uint32
+	Dropped        uint64    // 发送队列满丢弃的包数
+	LastReport     time.Time // 为零表示还没有收到 RR
+}
+
+// rtcpCNAME SDES CNAME，一个服务端所有流共用
+func rtcpCNAME() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return "go_rtsp@" + host
+}
+
+// sendSenderReports 定期给正在播放的会话发送 RTCP SR，
+// 播放端用它把 RTP 时间戳对应到墙上时间做音视频同步和录制
+func (s *RTSPServer) sendSenderReports() {
+	ticker := time.NewTicker(s.rtcpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		var playing []*StreamSession
+		s.mu.RLock()
+		for _, session := range s.sessions {
+			if !session.publishing {
+				playing = append(playing, session.trackSessions()...)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, session := range playing {
+			session.SendSenderReport(s.cname)
+		}
+	}
+}
+
+// HandleRTCP 处理客户端发来的 RTCP(UDP 或 interleaved)，收到即刷新活动时间。
+// 记录 RR 的丢包/抖动并计算 RTT，按 NACK 重传，PLI/FIR 和丢包过多时请求关键帧，收到 BYE 时结束会话
+func (s *StreamSession) HandleRTCP(data []byte) {
+	s.UpdateActivity()
+
+	packets, err := rtp.ParseRTCP(data)
+	if err != nil {
+		utils.Debug("Session %s invalid rtcp: %s", s.SessionID, err.Error())
+	}
+
+	now := time.Now()
+	bye := false
+	// 同一个复合包里的多个请求只触发一次，回调里还会按流限频
+	keyframeReason := KeyframeRequestReason(-1)
+	s.mu.Lock()
+	for _, packet := range packets {
+		switch packet.Type {
+		case rtp.RTCPTypeSR, rtp.RTCPTypeRR:
+			for _, report := range packet.Reports {
+				if s.ssrc != 0 && report.SSRC != s.ssrc {
+					continue
+				}
+				s.lastReport = report
+				s.lastReportAt = now
+				if s.lossThreshold > 0 && int(report.FractionLost)*100 > s.lossThreshold*256 {
+					keyframeReason = KeyframeRequestPacketLoss
+				}
+				if report.LSR != 0 {
+					// RTT = A - LSR - DLSR，单位 1/65536 秒，A 是收到报告时 NTP 时间的中间 32 位
+					arrival := uint32(rtp.NTPTimestamp(now) >> 16)
+					rtt := arrival - report.LSR - report.DLSR
+					if rtt < 1<<31 {
+						s.rtt = time.Duration(uint64(rtt) * uint64(time.Second) >> 16)
+					}
+				}
+			}
+		case rtp.RTCPTypeSDES:
+			if packet.CNAME != "" {
+				s.cname = packet.CNAME
+			}
+		case rtp.RTCPTypeRTPFB:
+			if packet.Subtype == rtp.RTPFBFormatNACK {
+				s.resend(rtp.ParseNACK(packet.Data))
+			}
+		case rtp.RTCPTypePSFB:
+			switch packet.Subtype {
+			case rtp.PSFBFormatPLI:
+				keyframeReason = KeyframeRequestPLI
+			case rtp.PSFBFormatFIR:
+				keyframeReason = KeyframeRequestFIR
+			}
+		case rtp.RTCPTypeBYE:
+			bye = true
+		case rtp.RTCPTypeAPP:
+			utils.Debug("Session %s rtcp app %s ignored", s.SessionID, packet.Name)
+		}
+	}
+	onBye := s.onRTCPBye
+	onKeyframe := s.onKeyframeRequest
+	s.mu.Unlock()
+
+	if onKeyframe != nil && keyframeReason >= 0 {
+		onKeyframe(s, keyframeReason)
+	}
+	if bye && onBye != nil {
+		onBye(s)
+	}
+}
+
+// Stats 返回客户端报告的接收质量
+func (s *StreamSession) Stats() ClientStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := ClientStats{
+		SessionID:      s.SessionID,
+		StreamPath:     s.StreamPath,
+		Track:          s.Track,
+		CNAME:          s.cname,
+		FractionLost:   float64(s.lastReport.FractionLost) / 256,
+		CumulativeLost: s.lastReport.CumulativeLost,
+		RTT:            s.rtt,
+		PacketsSent:    s.sentPackets.Load(),
+		Dropped:        s.Dropped,
+		LastReport:     s.lastReportAt,
+	}
+	clockRate := 90000
+	if s.Media != nil && s.Media.ClockRate > 0 {
+		clockRate = s.Media.ClockRate
+	}
+	stats.Jitter = time.Duration(uint64(s.lastReport.Jitter) * uint64(time.Second) / uint64(clockRate))
+	if s.RTSPConn != nil {
+		stats.RemoteAddr = s.RTSPConn.RemoteAddr().String()
+	}
+	return stats
+}
+
+// ClientStats 返回播放端每个轨道的接收质量，path 为空时返回所有流
+func (s *RTSPServer) ClientStats(path string) []ClientStats {
+	var sessions []*StreamSession
+	s.mu.RLock()
+	for _, session := range s.sessions {
+		if session.publishing || (path != "" && session.StreamPath != path) {
+			continue
+		}
+		sessions = append(sessions, session.trackSessions()...)
+	}
+	s.mu.RUnlock()
+
+	stats := make([]ClientStats, 0, len(sessions))
+	for _, session := range sessions {
+		stats = append(stats, session.Stats())
+	}
+	return stats
+}
+
+// handleRTCPBye 客户端发送 RTCP BYE，等同于 TEARDOWN
+func (s *RTSPServer) handleRTCPBye(session *StreamSession) {
+	utils.Info("Session %s received RTCP BYE, path %s", session.SessionID, session.StreamPath)
+	session = session.root()
+	session.Close()
+	s.removeSession(session.SessionID)
+	// 让连接上的读循环退出
+	if conn := session.rtspConn(); conn != nil {
+		conn.Close()
+	}
+}
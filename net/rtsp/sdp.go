@@ -0,0 +1,349 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+// MediaDescription SDP 中一个 m= 段里我们关心的内容
+type MediaDescription struct {
+	Type        string // video / audio
+	Port        int
+	Protocol    string // RTP/AVP
+	PayloadType int
+	Encoding    string // H265、H264 ...
+	ClockRate   int
+	Channels    int
+	Fmtp        string // a=fmtp:<pt> 后面的参数部分
+	Control     string
+
+	// 参数集(不带起始码)，有 SPS 时 fmtp 按参数集生成，否则使用 Fmtp
+	VPS []byte
+	SPS []byte
+	PPS []byte
+	// MPEG4-GENERIC 的 AudioSpecificConfig，fmtp 里的 config=
+	AudioConfig []byte
+	// a=framerate / a=x-dimensions，为 0 时不输出，分辨率为 0 时从 SPS 解析
+	FrameRate float64
+	Width     int
+	Height    int
+	// 支持 Generic NACK 时 m= 行使用 RTP/AVPF(RFC 4585)并输出 a=rtcp-fb:<pt> nack，
+	// RTXPayloadType 不为 0 时声明 RFC 4588 RTX
+	NACK           bool
+	RTXPayloadType int
+	// RTX 流的 SSRC，和原始流的 SSRC 用 a=ssrc-group:FID 关联(RFC 4588 §8.3)，
+	// SSRC 为 0 表示还没有收到推流，只声明 RTXSSRC
+	SSRC    uint32
+	RTXSSRC uint32
+	// 不为 0 时声明 ULPFEC(RFC 5109) 的负载类型
+	FECPayloadType int
+}
+
+// NewH265Media 默认的 H.265 视频媒体描述
+func NewH265Media() *MediaDescription {
+	return &MediaDescription{
+		Type:        "video",
+		Protocol:    "RTP/AVP",
+		PayloadType: 96,
+		Encoding:    "H265",
+		ClockRate:   90000,
+	}
+}
+
+// NewH264Media H.264 视频媒体描述，和 RTPPacketizer 一致使用 packetization-mode=1
+func NewH264Media() *MediaDescription {
+	return &MediaDescription{
+		Type:        "video",
+		Protocol:    "RTP/AVP",
+		PayloadType: 96,
+		Encoding:    "H264",
+		ClockRate:   90000,
+		Fmtp:        "packetization-mode=1",
+	}
+}
+
+// NewAACMedia AAC 音频媒体描述(RFC 3640 AAC-hbr)，时钟频率就是采样率，
+// config 为 nil 时按 AAC-LC 生成 AudioSpecificConfig
+func NewAACMedia(sampleRate, channels int, config []byte) *MediaDescription {
+	if config == nil {
+		config = rtp.AudioSpecificConfig(2, sampleRate, channels)
+	}
+	return &MediaDescription{
+		Type:        "audio",
+		Protocol:    "RTP/AVP",
+		PayloadType: 97,
+		Encoding:    "MPEG4-GENERIC",
+		ClockRate:   sampleRate,
+		Channels:    channels,
+		AudioConfig: config,
+	}
+}
+
+// NewJPEGMedia Motion JPEG 视频媒体描述(RFC 2435)，静态负载类型 26
+func NewJPEGMedia() *MediaDescription {
+	return &MediaDescription{
+		Type:        "video",
+		Protocol:    "RTP/AVP",
+		PayloadType: rtp.PayloadTypeJPEG,
+		Encoding:    "JPEG",
+		ClockRate:   90000,
+	}
+}
+
+// NewPCMUMedia G.711 μ-law 音频媒体描述，静态负载类型 0
+func NewPCMUMedia() *MediaDescription {
+	return &MediaDescription{
+		Type:        "audio",
+		Protocol:    "RTP/AVP",
+		PayloadType: rtp.PayloadTypePCMU,
+		Encoding:    "PCMU",
+		ClockRate:   8000,
+	}
+}
+
+// NewPCMAMedia G.711 A-law 音频媒体描述，静态负载类型 8
+func NewPCMAMedia() *MediaDescription {
+	return &MediaDescription{
+		Type:        "audio",
+		Protocol:    "RTP/AVP",
+		PayloadType: rtp.PayloadTypePCMA,
+		Encoding:    "PCMA",
+		ClockRate:   8000,
+	}
+}
+
+// NewOpusMedia Opus 音频媒体描述(RFC 7587)，rtpmap 固定为 opus/48000/2，
+// channels 为 2 时通过 sprop-stereo 告诉接收端发送的是立体声
+func NewOpusMedia(channels int) *MediaDescription {
+	stereo := 0
+	if channels == 2 {
+		stereo = 1
+	}
+	return &MediaDescription{
+		Type:        "audio",
+		Protocol:    "RTP/AVP",
+		PayloadType: 111,
+		Encoding:    "opus",
+		ClockRate:   rtp.OpusClockRate,
+		Channels:    2,
+		Fmtp:        fmt.Sprintf("sprop-stereo=%d", stereo),
+	}
+}
+
+// NewPayloader 按编码创建打包器
+func (m *MediaDescription) NewPayloader() (rtp.Payloader, error) {
+	return rtp.NewPayloader(m.Encoding, uint8(m.PayloadType), uint32(m.ClockRate))
+}
+
+// FmtpParams 返回 a=fmtp 的参数，H.265/H.264 有 SPS 时带上参数集和 profile/level，
+// AAC 带上 AU-header 的格式和 config
+func (m *MediaDescription) FmtpParams() string {
+	b64 := base64.StdEncoding.EncodeToString
+
+	switch {
+	case m.Encoding == "H265" && len(m.SPS) > 0:
+		var params []string
+		if info, err := utils.ParseH265SPS(m.SPS); err == nil {
+			if info.ProfileSpace != 0 {
+				params = append(params, fmt.Sprintf("profile-space=%d", info.ProfileSpace))
+			}
+			params = append(params,
+				fmt.Sprintf("profile-id=%d", info.ProfileID),
+				fmt.Sprintf("tier-flag=%d", info.TierFlag),
+				fmt.Sprintf("level-id=%d", info.LevelID))
+		}
+		if len(m.VPS) > 0 {
+			params = append(params, "sprop-vps="+b64(m.VPS))
+		}
+		params = append(params, "sprop-sps="+b64(m.SPS))
+		if len(m.PPS) > 0 {
+			params = append(params, "sprop-pps="+b64(m.PPS))
+		}
+		return strings.Join(params, ";")
+
+	case m.Encoding == "H264" && len(m.SPS) > 0:
+		params := []string{"packetization-mode=1"}
+		if len(m.SPS) >= 4 {
+			params = append(params, fmt.Sprintf("profile-level-id=%02x%02x%02x", m.SPS[1], m.SPS[2], m.SPS[3]))
+		}
+		sets := b64(m.SPS)
+		if len(m.PPS) > 0 {
+			sets += "," + b64(m.PPS)
+		}
+		params = append(params, "sprop-parameter-sets="+sets)
+		return strings.Join(params, ";")
+
+	case m.Encoding == "MPEG4-GENERIC" && len(m.AudioConfig) > 0:
+		return fmt.Sprintf("streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=%d;indexlength=%d;indexdeltalength=%d;config=%s",
+			rtp.AACSizeLength, rtp.AACIndexLength, rtp.AACIndexLength, hex.EncodeToString(m.AudioConfig))
+	}
+	return m.Fmtp
+}
+
+// Dimensions 返回分辨率，没有设置时从 SPS 解析
+func (m *MediaDescription) Dimensions() (int, int) {
+	if m.Width > 0 && m.Height > 0 {
+		return m.Width, m.Height
+	}
+	switch {
+	case m.Encoding == "H265" && len(m.SPS) > 0:
+		if info, err := utils.ParseH265SPS(m.SPS); err == nil {
+			return info.Width, info.Height
+		}
+	case m.Encoding == "H264" && len(m.SPS) > 0:
+		if info, err := utils.ParseH264SPS(m.SPS); err == nil {
+			return info.Width, info.Height
+		}
+	}
+	return 0, 0
+}
+
+// WriteSDP 输出这个媒体的 m= 段
+func (m *MediaDescription) WriteSDP(b *strings.Builder, port int, control string) {
+	protocol := m.Protocol
+	if protocol == "" {
+		protocol = "RTP/AVP"
+	}
+	if m.NACK && protocol == "RTP/AVP" {
+		// rtcp-fb 只能用在 AVPF 下
+		protocol = "RTP/AVPF"
+	}
+	formats := strconv.Itoa(m.PayloadType)
+	if m.RTXPayloadType > 0 {
+		formats += " " + strconv.Itoa(m.RTXPayloadType)
+	}
+	if m.FECPayloadType > 0 {
+		formats += " " + strconv.Itoa(m.FECPayloadType)
+	}
+	fmt.Fprintf(b, "m=%s %d %s %s\r\n", m.Type, port, protocol, formats)
+	if m.Channels > 0 {
+		fmt.Fprintf(b, "a=rtpmap:%d %s/%d/%d\r\n", m.PayloadType, m.Encoding, m.ClockRate, m.Channels)
+	} else {
+		fmt.Fprintf(b, "a=rtpmap:%d %s/%d\r\n", m.PayloadType, m.Encoding, m.ClockRate)
+	}
+	if fmtp := m.FmtpParams(); fmtp != "" {
+		fmt.Fprintf(b, "a=fmtp:%d %s\r\n", m.PayloadType, fmtp)
+	}
+	if m.NACK {
+		fmt.Fprintf(b, "a=rtcp-fb:%d nack\r\n", m.PayloadType)
+	}
+	if m.RTXPayloadType > 0 {
+		fmt.Fprintf(b, "a=rtpmap:%d rtx/%d\r\n", m.RTXPayloadType, m.ClockRate)
+		fmt.Fprintf(b, "a=fmtp:%d apt=%d\r\n", m.RTXPayloadType, m.PayloadType)
+		if m.RTXSSRC != 0 {
+			cname := rtcpCNAME()
+			if m.SSRC != 0 {
+				fmt.Fprintf(b, "a=ssrc-group:FID %d %d\r\n", m.SSRC, m.RTXSSRC)
+				fmt.Fprintf(b, "a=ssrc:%d cname:%s\r\n", m.SSRC, cname)
+			}
+			fmt.Fprintf(b, "a=ssrc:%d cname:%s\r\n", m.RTXSSRC, cname)
+		}
+	}
+	if m.FECPayloadType > 0 {
+		fmt.Fprintf(b, "a=rtpmap:%d ulpfec/%d\r\n", m.FECPayloadType, m.ClockRate)
+	}
+	if m.FrameRate > 0 {
+		fmt.Fprintf(b, "a=framerate:%s\r\n", strconv.FormatFloat(m.FrameRate, 'f', -1, 64))
+	}
+	if width, height := m.Dimensions(); width > 0 && height > 0 {
+		fmt.Fprintf(b, "a=x-dimensions:%d,%d\r\n", width, height)
+	}
+	fmt.Fprintf(b, "a=control:%s\r\n", control)
+}
+
+// SessionDescription ANNOUNCE 带上来的 SDP
+type SessionDescription struct {
+	Name    string
+	Control string
+	Medias  []*MediaDescription
+}
+
+// FirstMedia 返回第一个 mediaType 类型的 m= 段
+func (d *SessionDescription) FirstMedia(mediaType string) *MediaDescription {
+	for _, media := range d.Medias {
+		if media.Type == mediaType {
+			return media
+		}
+	}
+	return nil
+}
+
+// ParseSDP 解析 SDP，只处理 m=、a=rtpmap、a=fmtp、a=control 这几行
+func ParseSDP(body string) (*SessionDescription, error) {
+	desc := &SessionDescription{}
+	var current *MediaDescription
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		value := line[2:]
+
+		switch line[0] {
+		case 's':
+			desc.Name = value
+		case 'm':
+			// m=<media> <port> <proto> <fmt> ...
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("invalid media line: %q", line)
+			}
+			port, _ := strconv.Atoi(strings.Split(fields[1], "/")[0])
+			payloadType, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid payload type: %q", line)
+			}
+			current = &MediaDescription{
+				Type:        fields[0],
+				Port:        port,
+				Protocol:    fields[2],
+				PayloadType: payloadType,
+			}
+			desc.Medias = append(desc.Medias, current)
+		case 'a':
+			name, attr, _ := strings.Cut(value, ":")
+			if current == nil {
+				if name == "control" {
+					desc.Control = attr
+				}
+				continue
+			}
+			switch name {
+			case "control":
+				current.Control = attr
+			case "rtpmap":
+				// a=rtpmap:<pt> <encoding>/<clock>[/<channels>]
+				pt, encoding, _ := strings.Cut(attr, " ")
+				if p, err := strconv.Atoi(pt); err != nil || p != current.PayloadType {
+					continue
+				}
+				parts := strings.Split(encoding, "/")
+				current.Encoding = parts[0]
+				if len(parts) > 1 {
+					current.ClockRate, _ = strconv.Atoi(parts[1])
+				}
+				if len(parts) > 2 {
+					current.Channels, _ = strconv.Atoi(parts[2])
+				}
+			case "fmtp":
+				pt, params, _ := strings.Cut(attr, " ")
+				if p, err := strconv.Atoi(pt); err != nil || p != current.PayloadType {
+					continue
+				}
+				current.Fmtp = strings.TrimSpace(params)
+			}
+		}
+	}
+
+	if len(desc.Medias) == 0 {
+		return nil, fmt.Errorf("no media in sdp")
+	}
+	return desc, nil
+}
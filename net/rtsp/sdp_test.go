@@ -0,0 +1,151 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NACK/RTX 的 SDP 属性：rtcp-fb 只在 AVPF 下出现，RTX 的 SSRC 和原始流关联
+func TestMediaDescriptionWriteSDPFeedback(t *testing.T) {
+	cname := rtcpCNAME()
+	tests := []struct {
+		name    string
+		media   MediaDescription
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "plain",
+			media:   MediaDescription{},
+			want:    []string{"m=video 0 RTP/AVP 96"},
+			notWant: []string{"a=rtcp-fb", "a=ssrc"},
+		},
+		{
+			name:    "nack switches to avpf",
+			media:   MediaDescription{NACK: true},
+			want:    []string{"m=video 0 RTP/AVPF 96", "a=rtcp-fb:96 nack"},
+			notWant: []string{"a=ssrc"},
+		},
+		{
+			name:  "rtx with known ssrc",
+			media: MediaDescription{NACK: true, RTXPayloadType: 97, SSRC: 0x11223344, RTXSSRC: 0x55667788},
+			want: []string{
+				"m=video 0 RTP/AVPF 96 97",
+				"a=rtpmap:97 rtx/90000",
+				"a=fmtp:97 apt=96",
+				"a=ssrc-group:FID 287454020 1432778632",
+				"a=ssrc:287454020 cname:" + cname,
+				"a=ssrc:1432778632 cname:" + cname,
+			},
+		},
+		{
+			name:    "rtx before the publisher sends",
+			media:   MediaDescription{NACK: true, RTXPayloadType: 97, RTXSSRC: 0x55667788},
+			want:    []string{"a=ssrc:1432778632 cname:" + cname},
+			notWant: []string{"a=ssrc-group"},
+		},
+		{
+			name:    "other profile kept",
+			media:   MediaDescription{Protocol: "RTP/SAVPF", NACK: true},
+			want:    []string{"m=video 0 RTP/SAVPF 96"},
+			notWant: []string{"RTP/AVPF"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			media := tt.media
+			media.Type = "video"
+			media.PayloadType = 96
+			media.Encoding = "H265"
+			media.ClockRate = 90000
+			var b strings.Builder
+			media.WriteSDP(&b, 0, "streamid=0")
+			lines := strings.Split(b.String(), "\r\n")
+			for _, want := range tt.want {
+				if !containsLine(lines, want) {
+					t.Errorf("missing %q in:\n%s", want, b.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(b.String(), notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, b.String())
+				}
+			}
+		})
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+// DESCRIBE 声明的 RTX SSRC 就是重传包使用的 SSRC，SETUP 按客户端的 AVPF profile 应答
+func TestDescribeRetransmitSSRC(t *testing.T) {
+	server := newTestServer(t, RTSPServerInitConfig{NACKEnable: true, RTXEnable: true})
+	server.AddPath("live")
+	packet := h265TestPacket(1, 3000)
+	binary.BigEndian.PutUint32(packet[8:12], 0xCAFEBABE)
+	server.PushVideoFrame("live", packet, 3000, true)
+
+	client := newTestClient(t, server)
+	resp := client.request(t, MethodDescribe, "rtsp://host/live", nil)
+	if resp.status != 200 {
+		t.Fatalf("DESCRIBE status = %d", resp.status)
+	}
+	var rtxSSRC uint32
+	for _, line := range strings.Split(resp.body, "\r\n") {
+		if rest, ok := strings.CutPrefix(line, fmt.Sprintf("a=ssrc-group:FID %d ", uint32(0xCAFEBABE))); ok {
+			n, err := strconv.ParseUint(rest, 10, 32)
+			if err != nil {
+				t.Fatalf("bad ssrc-group %q", line)
+			}
+			rtxSSRC = uint32(n)
+		}
+	}
+	if rtxSSRC == 0 || !strings.Contains(resp.body, " RTP/AVPF 96 97\r\n") {
+		t.Fatalf("rtx ssrc not announced:\n%s", resp.body)
+	}
+
+	control := "rtsp://host/live/" + sdpControl(resp.body, 0)
+	resp = client.request(t, MethodSetup, control, map[string]string{"Transport": "RTP/AVPF/TCP;unicast;interleaved=0-1"})
+	if resp.status != 200 || resp.headers["Transport"] != "RTP/AVPF/TCP;interleaved=0-1" {
+		t.Fatalf("SETUP status = %d transport = %q", resp.status, resp.headers["Transport"])
+	}
+
+	server.mu.RLock()
+	var session *StreamSession
+	for _, s := range server.sessions {
+		session = s
+	}
+	server.mu.RUnlock()
+
+	// 按 UDP 客户端重传一个包，不启动发送 goroutine，直接从发送队列里取
+	session.mu.Lock()
+	session.isTcp = false
+	session.State = "playing"
+	session.recordSent(packet)
+	session.resend([]uint16{1})
+	session.mu.Unlock()
+
+	select {
+	case sent := <-session.sendQueue:
+		if got := binary.BigEndian.Uint32(sent.data[8:12]); got != rtxSSRC {
+			t.Fatalf("rtx ssrc = %d, want %d", got, rtxSSRC)
+		}
+		if sent.data[1]&0x7F != 97 || binary.BigEndian.Uint16(sent.data[12:14]) != 1 {
+			t.Fatalf("not an rtx packet: % X", sent.data[:14])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing resent")
+	}
+}
@@ -0,0 +1,188 @@
+package rtsp
+
+import (
+	"net"
+	"time"
+
+	"github.com/tthhr/go_rtsp/net/rtp"
+	"github.com/tthhr/go_rtsp/net/transport"
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+const (
+	defaultSendQueueSize = 1024
+	defaultWriteTimeout  = 5 * time.Second
+)
+
+// outboundPacket 发送队列中的一个包
+type outboundPacket struct {
+	data   []byte
+	rtcp   bool // RTCP 包走 RTCP 通道/端口
+	repair bool // NACK 重传和 FEC 的包，不计入 SR 的统计
+}
+
+// configureSending 设置发送队列参数，由服务端在创建 session 时调用
+func (s *StreamSession) configureSending(queueSize int, writeTimeout time.Duration, policy SlowClientPolicy) {
+	s.sendQueue = make(chan outboundPacket, queueSize)
+	s.sendDone = make(chan struct{})
+	s.writeTimeout = writeTimeout
+	s.slowClientPolicy = policy
+}
+
+// startWriter 启动发送 goroutine，只启动一次，调用者持有 s.mu
+func (s *StreamSession) startWriter() {
+	if s.writerStarted || s.sendQueue == nil {
+		return
+	}
+	s.writerStarted = true
+	go s.writeLoop()
+}
+
+// enqueue 非阻塞地放入发送队列，调用者持有 s.mu。
+// 队列满说明客户端跟不上，按 slowClientPolicy 丢到下一个关键帧或者断开
+func (s *StreamSession) enqueue(packet outboundPacket) {
+	if s.sendQueue == nil {
+		// 没有配置发送队列时直接同步发送
+		s.writePacket(packet)
+		return
+	}
+
+	select {
+	case s.sendQueue <- packet:
+		return
+	default:
+	}
+
+	s.Dropped++
+	switch s.slowClientPolicy {
+	case SlowClientDisconnect:
+		if !s.NeedClose {
+			utils.Warn("Session %s send queue full, disconnect", s.SessionID)
+			s.NeedClose = true
+			if s.RTSPConn != nil {
+				s.RTSPConn.Close()
+			}
+		}
+	default:
+		if !s.waitKeyframe {
+			utils.Warn("Session %s send queue full, drop to next keyframe", s.SessionID)
+			s.waitKeyframe = true
+		}
+	}
+}
+
+func (s *StreamSession) writeLoop() {
+	s.mu.Lock()
+	burst := s.burst
+	s.burst = nil
+	target := s.sendTarget()
+	s.mu.Unlock()
+
+	for _, packet := range burst {
+		if err := target.write(packet); err != nil && target.isTcp && target.conn != nil {
+			utils.Warn("Session %s write error: %s", s.SessionID, err.Error())
+			target.conn.Close()
+			return
+		}
+		s.countSent(packet)
+	}
+
+	for {
+		select {
+		case <-s.sendDone:
+			return
+		case packet := <-s.sendQueue:
+			// 写之前取一份发送目标，写的时候不持有锁，慢连接不会阻塞 SendRTPPacket
+			s.mu.RLock()
+			target := s.sendTarget()
+			s.mu.RUnlock()
+
+			if err := target.write(packet); err != nil && target.isTcp && target.conn != nil {
+				// TCP 写超时或者出错，关闭连接让读循环清理 session
+				utils.Warn("Session %s write error: %s", s.SessionID, err.Error())
+				target.conn.Close()
+				return
+			}
+			s.countSent(packet)
+		}
+	}
+}
+
+// countSent 统计发出的 RTP 包数和负载字节数
+func (s *StreamSession) countSent(packet outboundPacket) {
+	if packet.rtcp || packet.repair || len(packet.data) < 12 {
+		return
+	}
+	s.sentPackets.Add(1)
+	s.sentOctets.Add(uint32(len(packet.data) - 12))
+}
+
+// sendTarget 发送一个包需要的传输信息
+type sendTarget struct {
+	isTcp       bool
+	conn        net.Conn
+	rtpChannel  int
+	rtcpChannel int
+	timeout     time.Duration
+	rtpSender   *rtp.RTPSender
+	rtcpServer  *transport.UDPServer
+	rtpAddr     *net.UDPAddr
+	rtcpAddr    *net.UDPAddr
+}
+
+// sendTarget 调用者持有 s.mu
+func (s *StreamSession) sendTarget() sendTarget {
+	target := sendTarget{
+		isTcp:       s.isTcp,
+		conn:        s.RTSPConn,
+		rtpChannel:  s.RTPChannel,
+		rtcpChannel: s.RTCPChannel,
+		timeout:     s.writeTimeout,
+		rtpSender:   s.RTPSender,
+		rtcpServer:  s.UDPServerRTCP,
+		rtpAddr:     s.ClientAddr,
+	}
+	if s.ClientAddr != nil {
+		target.rtcpAddr = &net.UDPAddr{IP: s.ClientAddr.IP, Port: s.ClientRTCPort, Zone: s.ClientAddr.Zone}
+	}
+	return target
+}
+
+func (s *StreamSession) writePacket(packet outboundPacket) error {
+	err := s.sendTarget().write(packet)
+	if err == nil {
+		s.countSent(packet)
+	}
+	return err
+}
+
+func (t sendTarget) write(packet outboundPacket) error {
+	if t.isTcp && t.conn != nil {
+		channel := t.rtpChannel
+		if packet.rtcp {
+			channel = t.rtcpChannel
+		}
+		return transport.SendTCPData(t.conn, buildInterleavedFrame(packet.data, channel), t.timeout)
+	}
+
+	if packet.rtcp {
+		if t.rtcpServer != nil && t.rtcpAddr != nil && t.rtcpAddr.Port != 0 {
+			return t.rtcpServer.WriteTo(packet.data, t.rtcpAddr)
+		}
+	} else if t.rtpSender != nil && t.rtpAddr != nil {
+		return t.rtpSender.SendRawData(packet.data, t.rtpAddr)
+	}
+	return nil
+}
+
+// stopWriter 停止发送 goroutine，调用者持有 s.mu
+func (s *StreamSession) stopWriter() {
+	if s.sendDone == nil {
+		return
+	}
+	select {
+	case <-s.sendDone:
+	default:
+		close(s.sendDone)
+	}
+}
@@ -1,11 +1,12 @@
 package rtsp
 
 import (
-	"bufio"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tthhr/go_rtsp/net/transport"
 	"github.com/tthhr/go_rtsp/utils"
@@ -19,6 +20,14 @@ const (
 	StrategyIgnore                          // 2: 忽略限制（强行加入）
 )
 
+// SlowClientPolicy 客户端发送队列满(跟不上推流速度)时的处理
+type SlowClientPolicy int
+
+const (
+	SlowClientDropToKeyframe SlowClientPolicy = iota // 0: 丢包直到下一个关键帧
+	SlowClientDisconnect                             // 1: 断开客户端
+)
+
 type RTSPServerInitConfig struct {
 	Port        int
 	ProtocolLog bool
@@ -27,6 +36,69 @@ type RTSPServerInitConfig struct {
 	ServerName  string
 	MaxClient   int           //最大客户端数量
 	MaxAction   LimitStrategy //客户端满了之后的动作
+	// 会话超时时间(秒)，超过这个时间没有 RTSP 请求或 RTCP 报告的会话会被回收，<=0 时使用 60
+	SessionTimeout int
+	// 会话事件回调(超时回收等)，可以为 nil
+	OnSessionEvent func(event SessionEvent)
+	// 推流(ANNOUNCE/RECORD)到没有 AddPath 的路径时自动创建，推流结束后删除
+	PublishAutoCreate bool
+	// 认证，为 nil 时不做认证。DESCRIBE/SETUP/PLAY/ANNOUNCE/RECORD/GET_PARAMETER/SET_PARAMETER 需要认证
+	Authenticator Authenticator
+	AuthMode      AuthMode
+	AuthRealm     string // 为空时使用 ServerName
+	// Digest nonce 有效期(秒)，过期后用 stale=true 让客户端换新的 nonce，<=0 时使用 60
+	AuthNonceLifetime int
+	// RTSPS(RTSP over TLS)，启用后额外监听 TLSPort，TLS 连接上只允许 interleaved 传输
+	TLSEnable   bool
+	TLSPort     int    // 为 0 时使用 322
+	TLSCertFile string // TLSConfig 为 nil 时从证书/私钥文件加载
+	TLSKeyFile  string
+	TLSConfig   *tls.Config
+	// RTSP over HTTP 隧道，和 RTSP 共用端口，按第一行请求区分
+	HTTPTunnelEnable bool
+	// 每个客户端的发送队列长度(包数)，<=0 时使用 1024
+	SendQueueSize int
+	// TCP 发送超时(毫秒)，<=0 时使用 5000
+	WriteTimeout int
+	// 发送队列满时的处理
+	SlowClientPolicy SlowClientPolicy
+	// RTCP SR 发送间隔(秒)，0 时使用 5，<0 时不发送
+	RTCPInterval int
+	// 同一个流两次请求关键帧的最小间隔(毫秒)，<=0 时使用 1000
+	KeyframeRequestInterval int
+	// RR 报告的丢包率(百分比)超过该值时请求关键帧，0 时使用 10，<0 时不按丢包请求
+	KeyframeLossThreshold int
+	// UDP 客户端按 RTCP Generic NACK 重传，每个客户端保存最近 NACKBufferSize 个包，<=0 时使用 512
+	NACKEnable     bool
+	NACKBufferSize int
+	// 重传使用 RFC 4588 RTX 单独的负载类型(SDP 中声明)，否则原样重发
+	RTXEnable bool
+	// 组播，SETUP 带 multicast 的客户端加入流的组播组，每个流的包只发送一次。
+	// 每个流的组播地址从 MulticastAddress 开始递增(为空时使用 239.255.0.1)，
+	// RTP/RTCP 端口对在 MulticastPortMin~MulticastPortMax 内分配(为 0 时使用 40000~40999)，TTL<=0 时使用 16。
+	// 同时存在的组播组不超过端口对的数量，组里没有成员后地址和端口回收。
+	// 服务端接收成员发到 RTCP 端口的报告，组播客户端按 RTCP 或 RTSP 请求保活
+	MulticastEnable  bool
+	MulticastAddress string
+	MulticastPortMin int
+	MulticastPortMax int
+	MulticastTTL     int
+}
+
+const (
+	defaultSessionTimeout = 60
+	defaultTLSPort        = 322
+	defaultRTCPInterval   = 5
+	defaultNonceLifetime  = 60
+)
+
+// ParameterHandler 处理 GET_PARAMETER / SET_PARAMETER 携带的 text/parameters，
+// 应用层可以借此向客户端暴露码率、帧率之类的参数
+type ParameterHandler interface {
+	// GetParameter 返回 names 对应的值，不认识的参数返回 error
+	GetParameter(streamPath string, names []string) (map[string]string, error)
+	// SetParameter 设置参数，不认识或者不允许修改的参数返回 error
+	SetParameter(streamPath string, params map[string]string) error
 }
 
 type RTSPServer struct {
@@ -43,18 +115,134 @@ type RTSPServer struct {
 	sessionCounts  map[string]int
 	mu             sync.RWMutex
 	nextCSeq       int
+	hubs           map[hubKey]*streamHub // 路径和轨道 -> 播放端订阅列表
+	hubMu          sync.RWMutex
+	paramHandler   ParameterHandler
+	sessionTimeout time.Duration
+	onSessionEvent func(event SessionEvent)
+	stopChan       chan struct{}
+	authenticator  Authenticator
+	authMode       AuthMode
+	authRealm      string
+	nonceLifetime  time.Duration
+	tlsAddress     string
+	tlsConfig      *tls.Config
+	tlsServer      *transport.TCPServer
+
+	publishAutoCreate bool
+	publishers        map[string]*StreamSession      // 路径 -> 正在推流的 session
+	autoPaths         map[string]bool                // 推流时自动创建的路径
+	pathMedia         map[string][]*MediaDescription // AddPath 时声明的轨道
+
+	sendQueueSize    int
+	writeTimeout     time.Duration
+	slowClientPolicy SlowClientPolicy
+
+	rtcpInterval time.Duration
+	cname        string // SDES CNAME
+
+	keyframeHandler       func(streamPath string, reason KeyframeRequestReason)
+	keyframeInterval      time.Duration
+	keyframeLossThreshold int
+
+	nackEnable     bool
+	nackBufferSize int
+	rtxEnable      bool
+
+	multicast *multicastAllocator // 为 nil 时不支持组播
+
+	httpTunnelEnable bool
+	tunnels          map[string]*pendingTunnel // x-sessioncookie -> 等待 POST 的 GET 连接
+	tunnelMu         sync.Mutex
 }
 
-func (s *RTSPServer) AddPath(path string) {
+// AddPath 添加流路径，media 按顺序声明流的轨道(如 H.265 + AAC)，不传时为一个 H.265 轨道
+func (s *RTSPServer) AddPath(path string, media ...*MediaDescription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.availablePaths[path] = path
+
+	var tracks []*MediaDescription
+	for _, m := range media {
+		if m != nil {
+			tracks = append(tracks, m)
+		}
+	}
+	if len(tracks) > 0 {
+		s.pathMedia[path] = tracks
+	} else {
+		delete(s.pathMedia, path)
+	}
+	if _, publishing := s.publishers[path]; !publishing {
+		s.setHubMedia(path, s.pathMedia[path])
+	}
+}
+
+// setHubMedia 按轨道创建 hub 并交给它媒体描述，用于关键帧判断，调用者持有 s.mu。
+// 没有声明轨道时是一个 H.265 轨道
+func (s *RTSPServer) setHubMedia(path string, medias []*MediaDescription) {
+	for _, hub := range s.pathHubs(path) {
+		if hub.track >= len(medias) {
+			hub.setMedia(nil)
+		}
+	}
+	s.ensureHub(path, 0)
+	for track, media := range medias {
+		s.ensureHub(path, track).setMedia(media)
+	}
+}
+
+// streamMedias 流当前的轨道，有推流端时使用它 ANNOUNCE 的轨道，调用者持有 s.mu
+func (s *RTSPServer) streamMedias(path string) []*MediaDescription {
+	if publisher, ok := s.publishers[path]; ok {
+		return publisher.trackMedia
+	}
+	if medias := s.pathMedia[path]; len(medias) > 0 {
+		return medias
+	}
+	return []*MediaDescription{NewH265Media()}
+}
+
+// SetFEC 设置流的 ULPFEC 保护，UDP 客户端每 groupSize 个 RTP 包(最多 48)额外发一个 FEC 包，0 关闭。
+// 对流的所有轨道生效，路径需要先 AddPath。FEC 的负载类型在 DESCRIBE 时写入 SDP，修改前已经 DESCRIBE 的客户端不受影响
+func (s *RTSPServer) SetFEC(path string, groupSize int) {
+	s.mu.RLock()
+	tracks := len(s.streamMedias(path))
+	s.mu.RUnlock()
+	for track := 0; track < tracks; track++ {
+		if hub := s.trackHub(path, track); hub != nil {
+			hub.setFECLevel(groupSize)
+		}
+	}
+}
+
+// SetGOPCache 开关流的 GOP 缓存，maxBytes<=0 时使用 4MB。
+// 开启后新的播放端立即收到最近一个关键帧开始的内容，路径需要先 AddPath
+func (s *RTSPServer) SetGOPCache(path string, enabled bool, maxBytes int) {
+	if hub := s.getHub(path); hub != nil {
+		hub.configureGOPCache(enabled, maxBytes)
+	}
 }
 func (s *RTSPServer) RemovePath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.availablePaths[path] = ""
+	delete(s.pathMedia, path)
+	if _, publishing := s.publishers[path]; !publishing {
+		s.removeHubs(path)
+	}
+}
+func (s *RTSPServer) SetParameterHandler(handler ParameterHandler) {
+	s.mu.Lock()
+	s.paramHandler = handler
+	s.mu.Unlock()
 }
 func (s *RTSPServer) GetSessionCount(path string) int {
 	var count = 0
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	for _, session := range s.sessions {
-		if strings.HasPrefix(session.StreamPath, path) {
+		if session.StreamPath == path {
 			count++
 		}
 	}
@@ -68,6 +256,58 @@ func NewRTSPServer(config RTSPServerInitConfig) (*RTSPServer, error) {
 	if !config.UdpEnable && !config.TcpEnable {
 		return nil, fmt.Errorf("err tcp & udp all disable")
 	}
+	if config.SessionTimeout <= 0 {
+		config.SessionTimeout = defaultSessionTimeout
+	}
+	if config.SendQueueSize <= 0 {
+		config.SendQueueSize = defaultSendQueueSize
+	}
+	if config.RTCPInterval == 0 {
+		config.RTCPInterval = defaultRTCPInterval
+	}
+	if config.KeyframeRequestInterval <= 0 {
+		config.KeyframeRequestInterval = defaultKeyframeRequestInterval
+	}
+	if config.KeyframeLossThreshold == 0 {
+		config.KeyframeLossThreshold = defaultKeyframeLossThreshold
+	}
+	writeTimeout := defaultWriteTimeout
+	if config.WriteTimeout > 0 {
+		writeTimeout = time.Duration(config.WriteTimeout) * time.Millisecond
+	}
+	if config.AuthRealm == "" {
+		config.AuthRealm = config.ServerName
+	}
+	if config.AuthNonceLifetime <= 0 {
+		config.AuthNonceLifetime = defaultNonceLifetime
+	}
+
+	var multicast *multicastAllocator
+	if config.MulticastEnable {
+		var err error
+		multicast, err = newMulticastAllocator(config.MulticastAddress, config.MulticastPortMin, config.MulticastPortMax, config.MulticastTTL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tlsConfig *tls.Config
+	tlsAddress := ""
+	if config.TLSEnable {
+		tlsConfig = config.TLSConfig
+		if tlsConfig == nil {
+			cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("load tls cert fail: %v", err)
+			}
+			tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+		if config.TLSPort == 0 {
+			config.TLSPort = defaultTLSPort
+		}
+		tlsAddress = fmt.Sprintf(":%d", config.TLSPort)
+	}
+
 	return &RTSPServer{
 		availablePaths: make(map[string]string),
 		address:        fmt.Sprintf(":%d", config.Port),
@@ -80,6 +320,40 @@ func NewRTSPServer(config RTSPServerInitConfig) (*RTSPServer, error) {
 		sessions:       make(map[string]*StreamSession),
 		sessionCounts:  make(map[string]int),
 		nextCSeq:       1,
+		hubs:           make(map[hubKey]*streamHub),
+		sessionTimeout: time.Duration(config.SessionTimeout) * time.Second,
+		onSessionEvent: config.OnSessionEvent,
+		stopChan:       make(chan struct{}),
+		authenticator:  config.Authenticator,
+		authMode:       config.AuthMode,
+		authRealm:      config.AuthRealm,
+		nonceLifetime:  time.Duration(config.AuthNonceLifetime) * time.Second,
+		tlsAddress:     tlsAddress,
+		tlsConfig:      tlsConfig,
+
+		publishAutoCreate: config.PublishAutoCreate,
+		publishers:        make(map[string]*StreamSession),
+		autoPaths:         make(map[string]bool),
+		pathMedia:         make(map[string][]*MediaDescription),
+
+		sendQueueSize:    config.SendQueueSize,
+		writeTimeout:     writeTimeout,
+		slowClientPolicy: config.SlowClientPolicy,
+
+		rtcpInterval: time.Duration(config.RTCPInterval) * time.Second,
+		cname:        rtcpCNAME(),
+
+		keyframeInterval:      time.Duration(config.KeyframeRequestInterval) * time.Millisecond,
+		keyframeLossThreshold: config.KeyframeLossThreshold,
+
+		nackEnable:     config.NACKEnable,
+		nackBufferSize: config.NACKBufferSize,
+		rtxEnable:      config.RTXEnable,
+
+		multicast: multicast,
+
+		httpTunnelEnable: config.HTTPTunnelEnable,
+		tunnels:          make(map[string]*pendingTunnel),
 	}, nil
 }
 
@@ -90,9 +364,25 @@ func (s *RTSPServer) Start() error {
 	}
 
 	s.tcpServer = tcpServer
-	s.tcpServer.Handler = s.handleRTSPConnection
+	s.tcpServer.Handler = s.handleConnection
+
+	if s.tlsConfig != nil {
+		tlsServer, err := transport.NewTLSServer(s.tlsAddress, s.tlsConfig)
+		if err != nil {
+			tcpServer.Stop()
+			return err
+		}
+		s.tlsServer = tlsServer
+		s.tlsServer.Handler = s.handleConnection
+		go s.tlsServer.Start()
+		utils.Info("RTSPS server started on %s", s.tlsAddress)
+	}
 
 	go s.tcpServer.Start()
+	go s.reapSessions()
+	if s.rtcpInterval > 0 {
+		go s.sendSenderReports()
+	}
 	utils.Info("RTSP server started on %s", s.address)
 
 	return nil
@@ -102,6 +392,12 @@ func (s *RTSPServer) Stop() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	select {
+	case <-s.stopChan:
+	default:
+		close(s.stopChan)
+	}
+
 	// Close all sessions
 	for _, session := range s.sessions {
 		session.Close()
@@ -112,6 +408,17 @@ func (s *RTSPServer) Stop() {
 	if s.tcpServer != nil {
 		s.tcpServer.Stop()
 	}
+	if s.tlsServer != nil {
+		s.tlsServer.Stop()
+	}
+
+	s.tunnelMu.Lock()
+	for cookie, pending := range s.tunnels {
+		pending.timer.Stop()
+		pending.conn.Close()
+		delete(s.tunnels, cookie)
+	}
+	s.tunnelMu.Unlock()
 
 	utils.Info("RTSP server stopped")
 }
@@ -122,8 +429,9 @@ func (s *RTSPServer) handleRTSPConnection(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
 	utils.Info("New RTSP connection from %s", clientAddr)
 
-	reader := bufio.NewReader(conn)
+	rtspReader := NewRTSPReader(conn)
 	var currentSession *StreamSession
+	var auth connAuth
 
 	defer func() {
 		if currentSession != nil {
@@ -136,48 +444,55 @@ func (s *RTSPServer) handleRTSPConnection(conn net.Conn) {
 	}()
 
 	for {
-		// Read RTSP request
-		var requestBuilder strings.Builder
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
+		// Read RTSP request or interleaved frame
+		req, frame, err := rtspReader.ReadMessage()
+		if err != nil {
+			if err == ErrHeaderTooLarge || err == ErrBodyTooLarge {
+				utils.Error("Request too large from %s: %s", clientAddr, err.Error())
+				conn.Write([]byte(BuildRTSPResponse(413, "Request Entity Too Large", map[string]string{
+					"Server": s.serverName,
+				}, "")))
+			} else {
 				utils.Error("Read error: %s", err.Error())
-				return
 			}
+			return
+		}
 
-			requestBuilder.WriteString(line)
-			if line == "\r\n" {
-				break
-			}
+		if frame != nil {
+			s.handleInterleavedFrame(frame, currentSession)
+			continue
 		}
 
-		requestData := requestBuilder.String()
 		if s.protocolLog {
-			utils.Debug("Received request:\n%s", requestData)
+			utils.Debug("Received request:\n%s", req.raw)
 		}
 
-		// Parse request
-		req := ParseRTSPRequest(requestData)
-		if req == nil {
-			utils.Error("Failed to parse RTSP request")
-			return
+		// 任何 RTSP 请求都算作会话活动
+		if currentSession != nil {
+			currentSession.UpdateActivity()
 		}
 
-		// Get CSeq
-		cseq := 0
-		if cseqStr, ok := req.Headers["CSeq"]; ok {
-			fmt.Sscanf(cseqStr, "%d", &cseq)
-		}
+		cseq := req.Sequence
 
 		// Handle different methods
 		var response string
+		if s.authenticator != nil && requiresAuth(req.Method) {
+			if resp, ok := s.checkAuth(req, cseq, s.requestStreamPath(req, currentSession), &auth); !ok {
+				if s.protocolLog {
+					utils.Debug("Sending response:\n%s", resp)
+				}
+				conn.Write([]byte(resp))
+				continue
+			}
+		}
+
 		switch req.Method {
 		case MethodOptions:
 			response = s.handleOptions(req, cseq)
 		case MethodDescribe:
-			response = s.handleDescribe(req, cseq)
+			response = s.handleDescribe(req, cseq, conn)
 		case MethodSetup:
-			resp, session := s.handleSetup(req, cseq, conn)
+			resp, session := s.handleSetup(req, cseq, conn, currentSession)
 			response = resp
 			if session != nil {
 				currentSession = session
@@ -185,10 +500,20 @@ func (s *RTSPServer) handleRTSPConnection(conn net.Conn) {
 			}
 		case MethodPlay:
 			response = s.handlePlay(req, cseq, currentSession)
+		case MethodPause:
+			response = s.handlePause(req, cseq, currentSession)
+		case MethodGetParameter:
+			response = s.handleGetParameter(req, cseq, conn, currentSession, &auth)
+		case MethodSetParameter:
+			response = s.handleSetParameter(req, cseq, conn, currentSession, &auth)
 		case MethodTeardown:
 			response = s.handleTeardown(req, cseq, currentSession)
 		case MethodAnnounce:
-			response = s.handleAnnounce(req, cseq, requestData)
+			resp, session := s.handleAnnounce(req, cseq)
+			response = resp
+			if session != nil {
+				currentSession = session
+			}
 		case MethodRecord:
 			response = s.handleRecord(req, cseq, currentSession)
 		default:
@@ -206,16 +531,38 @@ func (s *RTSPServer) handleRTSPConnection(conn net.Conn) {
 	}
 }
 
+// handleInterleavedFrame 处理客户端通过 RTSP 连接发来的 '$' 帧：
+// 推流端 RTP 通道上的是媒体数据，其余(RTCP 接收报告)收到即刷新会话活动时间
+func (s *RTSPServer) handleInterleavedFrame(frame *InterleavedFrame, session *StreamSession) {
+	if session == nil {
+		return
+	}
+	track := session.trackByChannel(frame.Channel)
+	if track == nil {
+		session.UpdateActivity()
+		return
+	}
+	if track.publishing && frame.Channel == track.RTPChannel {
+		s.ingestRTP(track, frame.Data)
+		return
+	}
+	if frame.Channel == track.RTCPChannel {
+		track.HandleRTCP(frame.Data)
+		return
+	}
+	track.UpdateActivity()
+}
+
 func (s *RTSPServer) handleOptions(req *RTSPRequest, cseq int) string {
 	headers := map[string]string{
 		"CSeq":   fmt.Sprintf("%d", cseq),
-		"Public": "OPTIONS, DESCRIBE, SETUP, TEARDOWN, PLAY, ANNOUNCE, RECORD",
+		"Public": "OPTIONS, DESCRIBE, SETUP, TEARDOWN, PLAY, PAUSE, ANNOUNCE, RECORD, GET_PARAMETER, SET_PARAMETER",
 		"Server": s.serverName,
 	}
 	return BuildRTSPResponse(200, "OK", headers, "")
 }
 
-func (s *RTSPServer) handleDescribe(req *RTSPRequest, cseq int) string {
+func (s *RTSPServer) handleDescribe(req *RTSPRequest, cseq int, conn net.Conn) string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -244,18 +591,22 @@ func (s *RTSPServer) handleDescribe(req *RTSPRequest, cseq int) string {
 		case StrategyKickOldest:
 			session, found := s.GetOldestSessionByPath(streamPath)
 			if found && session != nil {
-				session.NeedClose = true
+				session.markClose()
 			}
 		}
 
 	}
 
 	// Create a temporary session for SDP generation
-	tempSession := NewStreamSession(streamPath)
+	tempSession := s.newSession(streamPath)
+	for track, media := range s.streamMedias(streamPath) {
+		tempSession.trackMedia = append(tempSession.trackMedia, s.playbackMedia(streamPath, track, media))
+	}
+	tempSession.Media = tempSession.trackMedia[0]
 	tempSession.SetupTransport("RTP/AVP/UDP", nil)
 	utils.Debug("create new seesion %s for %s", tempSession.SessionID, tempSession.StreamPath)
 
-	sdp := tempSession.GetSDP()
+	sdp := tempSession.GetSDP(sdpAddress(conn))
 	s.sessions[tempSession.SessionID] = tempSession
 	s.sessionCounts[streamPath]++
 
@@ -269,7 +620,7 @@ func (s *RTSPServer) handleDescribe(req *RTSPRequest, cseq int) string {
 	return BuildRTSPResponse(200, "OK", headers, sdp)
 }
 
-func (s *RTSPServer) handleSetup(req *RTSPRequest, cseq int, conn net.Conn) (string, *StreamSession) {
+func (s *RTSPServer) handleSetup(req *RTSPRequest, cseq int, conn net.Conn, current *StreamSession) (string, *StreamSession) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -280,6 +631,11 @@ func (s *RTSPServer) handleSetup(req *RTSPRequest, cseq int, conn net.Conn) (str
 
 	// Use existing session
 	session, ok = s.sessions[sessionID]
+	if !ok && current != nil && current.publishing {
+		// 推流端的 control 是它自己 SDP 里的(如 streamid=0)，session 来自 ANNOUNCE
+		session, ok = current, true
+		sessionID = current.SessionID
+	}
 	if !ok {
 		headers := map[string]string{
 			"CSeq":   fmt.Sprintf("%d", cseq),
@@ -288,22 +644,50 @@ func (s *RTSPServer) handleSetup(req *RTSPRequest, cseq int, conn net.Conn) (str
 		return BuildRTSPResponse(454, "Session Not Found", headers, ""), nil
 	}
 
-	// Parse transport
-	transport := req.Transport
+	// 多轨道时每个轨道 SETUP 一次，都聚合在同一个 Session 下
+	owner := session
+	track := trackFromURL(req.URL)
+	if owner.publishing {
+		track = mediaTrack(owner.trackMedia, req.URL)
+	}
+	if track >= owner.trackCount() {
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(404, "Not Found", headers, ""), nil
+	}
+	session = s.trackSession(owner, track)
 
 	// Parse client ports from transport header
-	mode, tcpOrUdp, clientRTPPort, clientRTCPPort, _, _, _, err := utils.ParseTransport(transport)
+	mode, tcpOrUdp, clientRTPPort, clientRTCPPort, _, _, _, err := utils.ParseTransport(req.Transport)
 	if err != nil {
 		utils.Error("ParseTransport fail %s", err.Error())
 	}
-	if (tcpOrUdp && !s.tcpEnable) || (!tcpOrUdp && !s.udpEnable) {
+	// RTSPS 下媒体数据也必须走 TLS，只接受 interleaved
+	if transport.IsTLSConn(conn) {
+		if !tcpOrUdp {
+			headers := map[string]string{
+				"CSeq":   fmt.Sprintf("%d", cseq),
+				"Server": s.serverName,
+			}
+			return BuildRTSPResponse(461, "Unsupported Transport", headers, ""), nil
+		}
+	} else if (tcpOrUdp && !s.tcpEnable) || (!tcpOrUdp && !s.udpEnable) {
 		headers := map[string]string{
 			"CSeq":   fmt.Sprintf("%d", cseq),
 			"Server": s.serverName,
 		}
 		return BuildRTSPResponse(405, "Method Not Support", headers, ""), nil
 	}
+	session.mu.Lock()
 	session.isTcp = tcpOrUdp
+	session.mu.Unlock()
+	if mode == "multicast" && !tcpOrUdp && !session.publishing {
+		response := s.setupMulticast(req, cseq, conn, session)
+		owner.attach(conn, false)
+		return response, owner
+	}
 	// Setup transport
 	var clientAddr *net.UDPAddr
 	if mode == "unicast" {
@@ -314,11 +698,13 @@ func (s *RTSPServer) handleSetup(req *RTSPRequest, cseq int, conn net.Conn) (str
 			IP:   net.ParseIP(clientIP),
 			Port: clientRTPPort,
 		}
+		session.mu.Lock()
 		session.ClientRTPPort = clientRTPPort
 		session.ClientRTCPort = clientRTCPPort
+		session.mu.Unlock()
 	}
 
-	err = session.SetupTransport(transport, clientAddr)
+	err = session.SetupTransport(req.Transport, clientAddr)
 	if err != nil {
 		utils.Error("SetupTransport error: %s", err.Error())
 		headers := map[string]string{
@@ -328,26 +714,39 @@ func (s *RTSPServer) handleSetup(req *RTSPRequest, cseq int, conn net.Conn) (str
 		return BuildRTSPResponse(500, "Internal Server Error", headers, ""), nil
 	}
 
-	// Prepare transport response
+	if rtpChannel, rtcpChannel, ok := utils.ParseInterleaved(req.Transport); ok && session.isTcp {
+		session.SetInterleavedChannels(rtpChannel, rtcpChannel)
+	}
+
+	// Prepare transport response，profile 和客户端请求的一致(SDP 声明 AVPF 时客户端会用 RTP/AVPF)
+	profile := "RTP/AVP"
+	if strings.HasPrefix(req.Transport, "RTP/AVPF") {
+		profile = "RTP/AVPF"
+	}
 	var transportResponse string
 	if session.isTcp {
-		transportResponse = "RTP/AVP/TCP;interleaved=0-1"
+		transportResponse = fmt.Sprintf("%s/TCP;interleaved=%d-%d", profile, session.RTPChannel, session.RTCPChannel)
 	} else {
-		transportResponse = fmt.Sprintf("RTP/AVP/UDP;unicast;client_port=%d-%d;server_port=%d-%d",
-			clientRTPPort, clientRTCPPort, session.ServerRTPPort, session.ServerRTCPPort)
+		transportResponse = fmt.Sprintf("%s/UDP;unicast;client_port=%d-%d;server_port=%d-%d",
+			profile, clientRTPPort, clientRTCPPort, session.ServerRTPPort, session.ServerRTCPPort)
+	}
+	if session.publishing {
+		transportResponse += ";mode=record"
 	}
 
 	headers := map[string]string{
 		"CSeq":      fmt.Sprintf("%d", cseq),
-		"Session":   sessionID + ";timeout=60",
+		"Session":   fmt.Sprintf("%s;timeout=%d", sessionID, int(s.sessionTimeout/time.Second)),
 		"Transport": transportResponse,
 		"Server":    s.serverName,
 	}
 
-	session.State = "ready"
-	session.RTSPConn = conn
+	session.configure(conn, req.URL)
+	if owner != session {
+		owner.attach(conn, true)
+	}
 
-	return BuildRTSPResponse(200, "OK", headers, ""), session
+	return BuildRTSPResponse(200, "OK", headers, ""), owner
 }
 
 func (s *RTSPServer) handlePlay(req *RTSPRequest, cseq int, session *StreamSession) string {
@@ -359,15 +758,97 @@ func (s *RTSPServer) handlePlay(req *RTSPRequest, cseq int, session *StreamSessi
 		return BuildRTSPResponse(454, "Session Not Found", headers, "")
 	}
 
-	session.State = "playing"
+	tracks := session.trackSessions()
+	if len(tracks) == 0 {
+		headers := map[string]string{
+			"CSeq":    fmt.Sprintf("%d", cseq),
+			"Session": session.SessionID,
+			"Server":  s.serverName,
+		}
+		return BuildRTSPResponse(455, "Method Not Valid in This State", headers, "")
+	}
+
+	// 首次 PLAY 和 PAUSE 之后的 PLAY 视频都从下一个关键帧开始发送(首次 PLAY 有 GOP 缓存时从缓存开始)，
+	// RTP-Info 中的 seq 就是第一个发出的包在本 session 中的序号，每个轨道一项。
+	// rtptime 只有从 GOP 缓存开始时才知道，否则不带，客户端以收到的第一个包为准
+	hubs := make([]*streamHub, len(tracks))
+	for i, track := range tracks {
+		if hubs[i] = s.trackHub(track.StreamPath, track.Track); hubs[i] == nil {
+			// SETUP 之后路径被删除
+			headers := map[string]string{
+				"CSeq":    fmt.Sprintf("%d", cseq),
+				"Session": session.SessionID,
+				"Server":  s.serverName,
+			}
+			return BuildRTSPResponse(404, "Not Found", headers, "")
+		}
+	}
+
+	var rtpInfo []string
+	waitKeyframe := false
+	for i, track := range tracks {
+		seq, rtptime, ok := hubs[i].play(track)
+		if track.waitingKeyframe() {
+			waitKeyframe = true
+		}
+
+		controlURL := track.ControlURL
+		if controlURL == "" {
+			controlURL = req.URL
+		}
+		info := fmt.Sprintf("url=%s;seq=%d", controlURL, seq)
+		if ok {
+			info += fmt.Sprintf(";rtptime=%d", rtptime)
+		}
+		rtpInfo = append(rtpInfo, info)
+	}
+	session.UpdateActivity()
+	if waitKeyframe {
+		// 不用等编码器的下一个 GOP
+		s.requestKeyframe(session.StreamPath, KeyframeRequestNewViewer)
+	}
+
+	headers := map[string]string{
+		"CSeq":     fmt.Sprintf("%d", cseq),
+		"Session":  session.SessionID,
+		"Range":    "npt=0.000-",
+		"RTP-Info": strings.Join(rtpInfo, ","),
+		"Server":   s.serverName,
+	}
+
+	return BuildRTSPResponse(200, "OK", headers, "")
+}
+
+func (s *RTSPServer) handlePause(req *RTSPRequest, cseq int, session *StreamSession) string {
+	if session == nil {
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(454, "Session Not Found", headers, "")
+	}
+
+	// RFC 2326 10.6: PAUSE 只在 playing/recording 状态下有意义
+	paused := false
+	for _, track := range session.trackSessions() {
+		if track.Pause() {
+			paused = true
+		}
+	}
+	if !paused {
+		headers := map[string]string{
+			"CSeq":    fmt.Sprintf("%d", cseq),
+			"Session": session.SessionID,
+			"Server":  s.serverName,
+		}
+		return BuildRTSPResponse(455, "Method Not Valid in This State", headers, "")
+	}
 	session.UpdateActivity()
 
 	headers := map[string]string{
 		"CSeq":    fmt.Sprintf("%d", cseq),
 		"Session": session.SessionID,
-		"Range":   "npt=0.000-",
-		//"RTP-Info": fmt.Sprintf("url=%s;seq=1", req.URL),
-		"Server": s.serverName,
+		"Server":  s.serverName,
 	}
 
 	return BuildRTSPResponse(200, "OK", headers, "")
@@ -388,31 +869,153 @@ func (s *RTSPServer) handleTeardown(req *RTSPRequest, cseq int, session *StreamS
 	return BuildRTSPResponse(200, "OK", headers, "")
 }
 
-func (s *RTSPServer) handleAnnounce(req *RTSPRequest, cseq int, body string) string {
-	// Announce is used to push SDP to server
+// setupMulticast 客户端加入流的组播组，Transport 响应带组播地址、端口和 TTL
+func (s *RTSPServer) setupMulticast(req *RTSPRequest, cseq int, conn net.Conn, session *StreamSession) string {
+	if s.multicast == nil {
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(461, "Unsupported Transport", headers, "")
+	}
+
+	hub := s.trackHub(session.StreamPath, session.Track)
+	if hub == nil {
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(404, "Not Found", headers, "")
+	}
+	group, err := hub.joinMulticast(session, s.multicast)
+	if err != nil {
+		utils.Error("Join multicast error: %s", err.Error())
+		headers := map[string]string{
+			"CSeq":   fmt.Sprintf("%d", cseq),
+			"Server": s.serverName,
+		}
+		return BuildRTSPResponse(500, "Internal Server Error", headers, "")
+	}
+
 	headers := map[string]string{
-		"CSeq":   fmt.Sprintf("%d", cseq),
-		"Server": s.serverName,
+		"CSeq":      fmt.Sprintf("%d", cseq),
+		"Session":   fmt.Sprintf("%s;timeout=%d", session.SessionID, int(s.sessionTimeout/time.Second)),
+		"Transport": group.transport(),
+		"Server":    s.serverName,
 	}
+
+	session.configure(conn, req.URL)
 	return BuildRTSPResponse(200, "OK", headers, "")
 }
 
-func (s *RTSPServer) handleRecord(req *RTSPRequest, cseq int, session *StreamSession) string {
+// requestStreamPath 返回请求对应的流路径，SETUP/PLAY 的 URL 带有 streamid，按 session 查找
+func (s *RTSPServer) requestStreamPath(req *RTSPRequest, session *StreamSession) string {
+	if req.Session != "" {
+		s.mu.RLock()
+		found, ok := s.sessions[req.Session]
+		s.mu.RUnlock()
+		if ok {
+			return found.StreamPath
+		}
+	}
+	if session != nil {
+		return session.StreamPath
+	}
+	return strings.TrimSuffix(extractStreamPath(req.URL), "/")
+}
+
+// parameterTarget 找到参数请求对应的 session 和流路径，
+// 同一个连接上的 session 优先，否则按 Session 头查找。
+// 开启认证时别的连接上的 session 只有当前用户对它的流有权限才能用，否则 ok 为 false
+func (s *RTSPServer) parameterTarget(req *RTSPRequest, conn net.Conn, session *StreamSession, auth *connAuth) (*StreamSession, string, bool) {
 	if session == nil {
-		headers := map[string]string{
-			"CSeq":   fmt.Sprintf("%d", cseq),
-			"Server": s.serverName,
+		if sessionID, ok := req.Headers["Session"]; ok {
+			sessionID = strings.TrimSpace(strings.Split(sessionID, ";")[0])
+			s.mu.RLock()
+			session = s.sessions[sessionID]
+			s.mu.RUnlock()
+			if session == nil {
+				return nil, "", false
+			}
+			if session.rtspConn() != conn && s.authenticator != nil &&
+				(auth.username == "" || !s.authenticator.Authorize(auth.username, session.StreamPath)) {
+				utils.Warn("Parameter request for session %s from another connection rejected", sessionID)
+				return nil, "", false
+			}
 		}
+	}
+	if session != nil {
+		return session, session.StreamPath, true
+	}
+	return nil, strings.TrimSuffix(extractStreamPath(req.URL), "/"), true
+}
+
+func (s *RTSPServer) handleGetParameter(req *RTSPRequest, cseq int, conn net.Conn, session *StreamSession, auth *connAuth) string {
+	session, streamPath, ok := s.parameterTarget(req, conn, session, auth)
+	headers := map[string]string{
+		"CSeq":   fmt.Sprintf("%d", cseq),
+		"Server": s.serverName,
+	}
+	if !ok {
 		return BuildRTSPResponse(454, "Session Not Found", headers, "")
 	}
+	if session != nil {
+		// 空的 GET_PARAMETER 是客户端的保活
+		session.UpdateActivity()
+		headers["Session"] = session.SessionID
+	}
 
-	session.State = "recording"
-	session.UpdateActivity()
+	names, _ := ParseTextParameters(req.Body)
+	if len(names) == 0 {
+		return BuildRTSPResponse(200, "OK", headers, "")
+	}
 
+	s.mu.RLock()
+	handler := s.paramHandler
+	s.mu.RUnlock()
+	if handler == nil {
+		return BuildRTSPResponse(451, "Parameter Not Understood", headers, "")
+	}
+
+	values, err := handler.GetParameter(streamPath, names)
+	if err != nil {
+		utils.Warn("GET_PARAMETER %s: %s", streamPath, err.Error())
+		return BuildRTSPResponse(451, "Parameter Not Understood", headers, "")
+	}
+
+	headers["Content-Type"] = "text/parameters"
+	return BuildRTSPResponse(200, "OK", headers, BuildTextParameters(names, values))
+}
+
+func (s *RTSPServer) handleSetParameter(req *RTSPRequest, cseq int, conn net.Conn, session *StreamSession, auth *connAuth) string {
+	session, streamPath, ok := s.parameterTarget(req, conn, session, auth)
 	headers := map[string]string{
-		"CSeq":    fmt.Sprintf("%d", cseq),
-		"Session": session.SessionID,
-		"Server":  s.serverName,
+		"CSeq":   fmt.Sprintf("%d", cseq),
+		"Server": s.serverName,
+	}
+	if !ok {
+		return BuildRTSPResponse(454, "Session Not Found", headers, "")
+	}
+	if session != nil {
+		session.UpdateActivity()
+		headers["Session"] = session.SessionID
+	}
+
+	_, params := ParseTextParameters(req.Body)
+	if len(params) == 0 {
+		return BuildRTSPResponse(200, "OK", headers, "")
+	}
+
+	s.mu.RLock()
+	handler := s.paramHandler
+	s.mu.RUnlock()
+	if handler == nil {
+		return BuildRTSPResponse(451, "Parameter Not Understood", headers, "")
+	}
+
+	if err := handler.SetParameter(streamPath, params); err != nil {
+		utils.Warn("SET_PARAMETER %s: %s", streamPath, err.Error())
+		return BuildRTSPResponse(451, "Parameter Not Understood", headers, "")
 	}
 
 	return BuildRTSPResponse(200, "OK", headers, "")
@@ -425,7 +1028,9 @@ func (s *RTSPServer) removeSession(sessionID string) {
 		// 获取该 session 对应的路径
 		path := sess.StreamPath
 
-		if s.sessionCounts[path] > 0 {
+		if sess.publishing {
+			// 推流端不占用 MaxClient 名额
+		} else if s.sessionCounts[path] > 0 {
 			s.sessionCounts[path]--
 		} else {
 			utils.Warn("Session count for %s is already 0, logic error?", path)
@@ -433,29 +1038,182 @@ func (s *RTSPServer) removeSession(sessionID string) {
 		}
 		//  从 map 中彻底删除
 		delete(s.sessions, sessionID)
+		if hub := s.getHub(path); hub != nil {
+			hub.unsubscribe(sess)
+		}
+		for _, track := range sess.trackSessions() {
+			if hub := s.trackHub(path, track.Track); hub != nil {
+				hub.unsubscribe(track)
+			}
+		}
+		if sess.publishing {
+			s.removePublisher(sess)
+		}
 		utils.Info("Session removed: %s, remaining count: %d", sessionID, s.sessionCounts[path])
 	}
 }
 
-func (s *RTSPServer) PushVideoFrame(streamPath string, data []byte, timestamp uint32, marker bool) error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// reapSessions 定期回收超过 sessionTimeout 没有活动的会话，
+// 防止不发 TEARDOWN 就消失的 UDP 客户端一直占着端口和 MaxClient 名额
+func (s *RTSPServer) reapSessions() {
+	interval := s.sessionTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	// Find all sessions for this stream path
-	for _, session := range s.sessions {
-		if strings.HasPrefix(session.StreamPath, streamPath) && session.State == "playing" {
-			//go session.SendRTPPacket(data, timestamp, marker)
-			session.SendRTPPacket(data, timestamp, marker)
-			if session.NeedClose && session.RTSPConn != nil {
-				utils.Info("session %s close", session.SessionID)
-				session.RTSPConn.Close()
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		var stale []*StreamSession
+		s.mu.RLock()
+		for _, session := range s.sessions {
+			if session.IdleTime() > s.sessionTimeout {
+				stale = append(stale, session)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, session := range stale {
+			utils.Warn("Session %s timeout, path %s", session.SessionID, session.StreamPath)
+			session.Close()
+			s.removeSession(session.SessionID)
+			// 让连接上的读循环退出
+			if conn := session.rtspConn(); conn != nil {
+				conn.Close()
 			}
+			s.emitEvent(EventSessionTimeout, session)
 		}
 	}
+}
+
+func (s *RTSPServer) PushVideoFrame(streamPath string, data []byte, timestamp uint32, marker bool) error {
+	return s.PushTrackPacket(streamPath, 0, data, timestamp, marker)
+}
 
+// PushTrackPacket 推送流中某个轨道的 RTP 包，track 是 AddPath 时 media 的序号，marker 决定发出去的包的 Marker 位
+func (s *RTSPServer) PushTrackPacket(streamPath string, track int, data []byte, timestamp uint32, marker bool) error {
+	hub := s.trackHub(streamPath, track)
+	if hub == nil {
+		return fmt.Errorf("stream %s has no track %d", streamPath, track)
+	}
+	hub.push(data, timestamp, marker)
 	return nil
 }
 
+// newSession 创建 session 并按服务端配置设置发送队列
+func (s *RTSPServer) newSession(streamPath string) *StreamSession {
+	session := NewStreamSession(streamPath)
+	session.configureSending(s.sendQueueSize, s.writeTimeout, s.slowClientPolicy)
+	session.onRTCPBye = s.handleRTCPBye
+	session.onKeyframeRequest = s.handleKeyframeRequest
+	session.lossThreshold = s.keyframeLossThreshold
+	if s.nackEnable {
+		session.enableRetransmit(s.nackBufferSize)
+	}
+	return session
+}
+
+// playbackMedia 播放端的媒体描述，开启 NACK/RTX/FEC 时复制一份加上对应的 SDP 属性
+func (s *RTSPServer) playbackMedia(path string, track int, media *MediaDescription) *MediaDescription {
+	hub := s.trackHub(path, track)
+	fec := hub != nil && hub.fecLevel() > 0
+	if !s.nackEnable && !fec {
+		return media
+	}
+	if media == nil {
+		media = NewH265Media()
+	}
+	playback := *media
+	if s.nackEnable {
+		playback.NACK = true
+		if s.rtxEnable {
+			playback.RTXPayloadType = freePayloadType(playback.PayloadType)
+			// 每次 DESCRIBE 的 RTX SSRC 不同，和当前推流的 SSRC 一起写进 SDP
+			if hub != nil {
+				playback.SSRC = hub.ssrc.Load()
+			}
+			playback.RTXSSRC = newRTXSSRC(playback.SSRC)
+		}
+	}
+	if fec {
+		playback.FECPayloadType = freePayloadType(playback.PayloadType, playback.RTXPayloadType)
+	}
+	return &playback
+}
+
+// sdpAddress 返回客户端连接的本机地址，监听在 0.0.0.0 时取一个网卡地址
+func sdpAddress(conn net.Conn) string {
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok && !addr.IP.IsUnspecified() {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			return ip4.String()
+		}
+		return addr.IP.String()
+	}
+	return utils.GetLocalIP()
+}
+
+// SetParameterSets 更新流的参数集，DESCRIBE 的 SDP 里带上 sprop-*，H.264 的 vps 传 nil
+func (s *RTSPServer) SetParameterSets(path string, vps, sps, pps []byte) {
+	s.updatePathMedia(path, "video", func(media *MediaDescription) {
+		media.VPS = vps
+		media.SPS = sps
+		media.PPS = pps
+	})
+}
+
+// SetVideoAttributes 设置 SDP 里的 a=framerate / a=x-dimensions，分辨率为 0 时从 SPS 解析
+func (s *RTSPServer) SetVideoAttributes(path string, frameRate float64, width, height int) {
+	s.updatePathMedia(path, "video", func(media *MediaDescription) {
+		media.FrameRate = frameRate
+		media.Width = width
+		media.Height = height
+	})
+}
+
+// SetAudioConfig 更新流中 AAC 轨道的 AudioSpecificConfig，DESCRIBE 的 SDP 里带上 config=
+func (s *RTSPServer) SetAudioConfig(path string, config []byte) {
+	s.updatePathMedia(path, "audio", func(media *MediaDescription) {
+		media.AudioConfig = config
+	})
+}
+
+// updatePathMedia 复制一份 mediaType 轨道的媒体描述再修改，已经拿到旧指针的 session 不受影响。
+// 没有声明过轨道时视频按默认的 H.265 处理，流里没有这个类型的轨道时不修改
+func (s *RTSPServer) updatePathMedia(path string, mediaType string, update func(media *MediaDescription)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	medias := append([]*MediaDescription(nil), s.pathMedia[path]...)
+	if len(medias) == 0 {
+		medias = []*MediaDescription{NewH265Media()}
+	}
+	track := -1
+	for i, media := range medias {
+		if media.Type == mediaType {
+			track = i
+			break
+		}
+	}
+	if track == -1 {
+		return
+	}
+	media := *medias[track]
+	update(&media)
+	medias[track] = &media
+	s.pathMedia[path] = medias
+	if _, publishing := s.publishers[path]; !publishing {
+		if hub := s.trackHub(path, track); hub != nil {
+			hub.setMedia(&media)
+		}
+	}
+}
+
 func extractStreamPath(url string) string {
 	// Remove protocol and host
 	if idx := strings.Index(url, "://"); idx > 0 {
@@ -0,0 +1,317 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testResponse struct {
+	status  int
+	headers map[string]string
+	body    string
+}
+
+// testClient 通过 net.Pipe 连到 handleRTSPConnection，后台读取响应，
+// interleaved 帧计数，通道 0 的 RTP 包放进 packets，满了就丢
+type testClient struct {
+	conn      net.Conn
+	responses chan testResponse
+	packets   chan []byte
+	frames    atomic.Int64
+	cseq      int
+}
+
+func newTestClient(t *testing.T, server *RTSPServer) *testClient {
+	t.Helper()
+	client, conn := net.Pipe()
+	go server.handleRTSPConnection(conn)
+	c := &testClient{conn: client, responses: make(chan testResponse, 16), packets: make(chan []byte, 64)}
+	go c.readLoop()
+	t.Cleanup(func() { client.Close() })
+	return c
+}
+
+func (c *testClient) readLoop() {
+	defer close(c.responses)
+	reader := bufio.NewReader(c.conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if first[0] == '$' {
+			header := make([]byte, 4)
+			if _, err := io.ReadFull(reader, header); err != nil {
+				return
+			}
+			data := make([]byte, int(header[2])<<8|int(header[3]))
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return
+			}
+			c.frames.Add(1)
+			if header[1] == 0 {
+				select {
+				case c.packets <- data:
+				default:
+				}
+			}
+			continue
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return
+		}
+		resp := testResponse{headers: make(map[string]string)}
+		resp.status, _ = strconv.Atoi(fields[1])
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			if name, value, ok := strings.Cut(line, ":"); ok {
+				resp.headers[name] = strings.TrimSpace(value)
+			}
+		}
+		if length, _ := strconv.Atoi(resp.headers["Content-Length"]); length > 0 {
+			body := make([]byte, length)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			resp.body = string(body)
+		}
+		c.responses <- resp
+	}
+}
+
+// request 发送一个请求并等待响应，headers 里不需要带 CSeq
+func (c *testClient) request(t *testing.T, method, url string, headers map[string]string) testResponse {
+	t.Helper()
+	c.cseq++
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\nCSeq: %d\r\n", method, url, c.cseq)
+	for name, value := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	b.WriteString("\r\n")
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+
+	select {
+	case resp, ok := <-c.responses:
+		if !ok {
+			t.Fatalf("%s: connection closed", method)
+		}
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: timed out", method)
+	}
+	return testResponse{}
+}
+
+// sdpControl 取出 SDP 里第 track 个 m= 段的 control
+func sdpControl(sdp string, track int) string {
+	index := -1
+	for _, line := range strings.Split(sdp, "\r\n") {
+		if strings.HasPrefix(line, "m=") {
+			index++
+		}
+		if index == track && strings.HasPrefix(line, "a=control:") {
+			return strings.TrimPrefix(line, "a=control:")
+		}
+	}
+	return ""
+}
+
+func newTestServer(t *testing.T, config RTSPServerInitConfig) *RTSPServer {
+	t.Helper()
+	config.TcpEnable = true
+	config.UdpEnable = true
+	if config.ServerName == "" {
+		config.ServerName = "test"
+	}
+	if config.MaxClient == 0 {
+		config.MaxClient = 10
+	}
+	server, err := NewRTSPServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// h265TestPacket 一个只有 IDR NALU 的 RTP 包
+func h265TestPacket(seq uint16, timestamp uint32) []byte {
+	packet := []byte{0x80, 0x80 | 96, byte(seq >> 8), byte(seq), byte(timestamp >> 24), byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp), 0, 0, 0, 1}
+	return append(packet, 19<<1, 0x01, 0xAF, 0x00)
+}
+
+// SETUP/PLAY/PAUSE 的状态修改和推流 goroutine 并发，配合 -race 检查
+func TestSessionStateWhilePushing(t *testing.T) {
+	server := newTestServer(t, RTSPServerInitConfig{})
+	server.AddPath("live")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.PushVideoFrame("live", h265TestPacket(uint16(i), uint32(i*3000)), uint32(i*3000), true)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 3; i++ {
+		client := newTestClient(t, server)
+		resp := client.request(t, MethodDescribe, "rtsp://host/live", nil)
+		if resp.status != 200 {
+			t.Fatalf("DESCRIBE status = %d", resp.status)
+		}
+		control := "rtsp://host/live/" + sdpControl(resp.body, 0)
+		transport := map[string]string{"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1"}
+		if resp := client.request(t, MethodSetup, control, transport); resp.status != 200 {
+			t.Fatalf("SETUP status = %d", resp.status)
+		}
+		if resp := client.request(t, MethodPlay, control, nil); resp.status != 200 {
+			t.Fatalf("PLAY status = %d", resp.status)
+		}
+		if resp := client.request(t, MethodPause, control, nil); resp.status != 200 {
+			t.Fatalf("PAUSE status = %d", resp.status)
+		}
+		if resp := client.request(t, MethodPlay, control, nil); resp.status != 200 {
+			t.Fatalf("second PLAY status = %d", resp.status)
+		}
+		// 播放中再次 SETUP，session 回到 ready，需要重新 PLAY
+		if resp := client.request(t, MethodSetup, control, transport); resp.status != 200 {
+			t.Fatalf("second SETUP status = %d", resp.status)
+		}
+		if resp := client.request(t, MethodPlay, control, nil); resp.status != 200 {
+			t.Fatalf("third PLAY status = %d", resp.status)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for client.frames.Load() == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if client.frames.Load() == 0 {
+			t.Fatal("no interleaved packets received")
+		}
+	}
+}
+
+// 组播成员 PLAY/PAUSE 和组播发送并发，配合 -race 检查
+func TestMulticastStateWhilePushing(t *testing.T) {
+	server := newTestServer(t, RTSPServerInitConfig{MulticastEnable: true, MulticastPortMin: 41000, MulticastPortMax: 41009})
+	server.AddPath("live")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.PushVideoFrame("live", h265TestPacket(uint16(i), uint32(i*3000)), uint32(i*3000), true)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 2; i++ {
+		client := newTestClient(t, server)
+		resp := client.request(t, MethodDescribe, "rtsp://host/live", nil)
+		if resp.status != 200 {
+			t.Fatalf("DESCRIBE status = %d", resp.status)
+		}
+		control := "rtsp://host/live/" + sdpControl(resp.body, 0)
+		resp = client.request(t, MethodSetup, control, map[string]string{"Transport": "RTP/AVP;multicast"})
+		if resp.status == 500 {
+			t.Skip("multicast sockets not available")
+		}
+		if resp.status != 200 || !strings.Contains(resp.headers["Transport"], "multicast") {
+			t.Fatalf("SETUP status = %d transport = %q", resp.status, resp.headers["Transport"])
+		}
+		for _, method := range []string{MethodPlay, MethodPause, MethodPlay} {
+			if resp := client.request(t, method, control, nil); resp.status != 200 {
+				t.Fatalf("%s status = %d", method, resp.status)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
+
+// 视频属性只写到视频轨道，纯音频的流不受影响
+func TestUpdatePathMedia(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xC0, 0x1E}
+	tests := []struct {
+		name   string
+		medias []*MediaDescription
+		video  int // 期望带上参数集的轨道，-1 表示没有
+	}{
+		{name: "default h265", medias: nil, video: 0},
+		{name: "audio only", medias: []*MediaDescription{NewAACMedia(48000, 2, nil)}, video: -1},
+		{name: "audio first", medias: []*MediaDescription{NewPCMUMedia(), NewH264Media()}, video: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, RTSPServerInitConfig{})
+			server.AddPath("live", tt.medias...)
+			server.SetParameterSets("live", nil, sps, nil)
+			server.SetVideoAttributes("live", 25, 640, 480)
+
+			server.mu.RLock()
+			medias := server.streamMedias("live")
+			server.mu.RUnlock()
+			for i, media := range medias {
+				updated := media.SPS != nil || media.FrameRate != 0 || media.Width != 0
+				if updated != (i == tt.video) {
+					t.Errorf("track %d (%s) updated = %v", i, media.Encoding, updated)
+				}
+			}
+
+			client := newTestClient(t, server)
+			resp := client.request(t, MethodDescribe, "rtsp://host/live", nil)
+			if !strings.Contains(resp.body, "\r\ns=live\r\n") {
+				t.Errorf("session name missing in sdp:\n%s", resp.body)
+			}
+			if tt.video == -1 && strings.Contains(resp.body, "sprop") {
+				t.Errorf("audio only sdp has parameter sets:\n%s", resp.body)
+			}
+		})
+	}
+}
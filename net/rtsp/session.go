@@ -4,7 +4,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tthhr/go_rtsp/net/rtp"
@@ -35,10 +37,66 @@ type StreamSession struct {
 	UDPServerRTCP *transport.UDPServer
 	RTPSender     *rtp.RTPSender
 
+	// SETUP 时的 URL，PLAY 响应的 RTP-Info 使用
+	ControlURL string
+	// 媒体描述，为 nil 时按默认的 H.265 生成 SDP
+	Media *MediaDescription
+	// 推流(ANNOUNCE/RECORD)的 session
+	publishing bool
+
+	// 多轨道: Track 是本轨道在 SDP 中的序号(trackID)。其他轨道的 session 挂在第 0 个轨道的 tracks 下，
+	// 共用 SessionID，只有第 0 个轨道的 session 在服务端的 sessions 里
+	Track      int
+	trackMedia []*MediaDescription // 整个流的轨道，只在第 0 个轨道上
+	tracks     map[int]*StreamSession
+	parent     *StreamSession
+	configured bool // 已经 SETUP
+	ingesting  bool // 已经开始读取推流端的 UDP RTP
+
 	LastActive time.Time
 	NeedClose  bool
-	Sequence   uint16
-	mu         sync.RWMutex
+	Sequence   uint16 // 本 session 下一个发出的 RTP 包序号
+	// PLAY/PAUSE 之后等待下一个关键帧再开始发送
+	waitKeyframe bool
+	played       bool
+	// 第一次 PLAY 时 GOP 缓存的内容，发送 goroutine 先发这些
+	burst []outboundPacket
+
+	// 发送队列，由独立的 goroutine 写出，慢客户端不会阻塞推流
+	sendQueue        chan outboundPacket
+	sendDone         chan struct{}
+	writerStarted    bool
+	writeTimeout     time.Duration
+	slowClientPolicy SlowClientPolicy
+	Dropped          uint64 // 发送队列满丢弃的包数
+
+	// 发送统计和最近一个 RTP 时间戳对应的墙上时间，生成 SR 使用
+	ssrc             uint32
+	lastRTPTimestamp uint32
+	lastRTPWall      time.Time
+	sentPackets      atomic.Uint32
+	sentOctets       atomic.Uint32
+
+	// 客户端 RTCP 报告的接收质量
+	cname        string
+	lastReport   rtp.ReceptionReport
+	lastReportAt time.Time
+	rtt          time.Duration
+	// NACK 重传，为 nil 时不重传
+	retransmit  *retransmitBuffer
+	rtxSequence uint16
+	// ULPFEC，为 nil 时不发送
+	fec *rtp.ULPFECEncoder
+	// 组播的 session 不单独发送，由流的组播组统一发送
+	multicast *multicastGroup
+
+	// 收到 RTCP BYE 时调用，由服务端设置
+	onRTCPBye func(session *StreamSession)
+	// 收到 PLI/FIR 或者丢包率(百分比)超过 lossThreshold 时调用，由服务端设置
+	onKeyframeRequest func(session *StreamSession, reason KeyframeRequestReason)
+	lossThreshold     int
+
+	mu sync.RWMutex
 }
 
 func NewStreamSession(streamPath string) *StreamSession {
@@ -70,6 +128,11 @@ func (s *StreamSession) SetupTransport(transport string, clientAddr *net.UDPAddr
 }
 
 func (s *StreamSession) setupUDPTransport() error {
+	// DESCRIBE 时已经分配过端口，SETUP 直接复用，避免泄漏
+	if s.UDPServerRTP != nil && s.UDPServerRTCP != nil {
+		return nil
+	}
+
 	// Find available ports for RTP
 	rtpPort, err := transport.FindAvailableUDPPort(30000)
 	if err != nil {
@@ -102,39 +165,209 @@ func (s *StreamSession) setupUDPTransport() error {
 	// Create RTP sender
 	s.RTPSender = rtp.NewRTPSender(rtpServer.Conn())
 
+	go s.readRTCP(rtcpServer)
+
 	utils.Info("UDP transport setup: RTP port=%d, RTCP port=%d", rtpPort, rtcpPort)
 	return nil
 }
 
 func (s *StreamSession) setupTCPTransport() error {
-	// For TCP interleaved, channels are set during SETUP
+	// 客户端没有指定 interleaved 时按轨道分配 0-1、2-3 ...
 	s.Interleaved = true
-	s.RTPChannel = 0
-	s.RTCPChannel = 1
+	s.RTPChannel = 2 * s.Track
+	s.RTCPChannel = 2*s.Track + 1
 	utils.Info("TCP interleaved transport setup")
 	return nil
 }
 
+// Pause 将 playing 状态的 session 切回 ready，不关闭任何 socket
+func (s *StreamSession) Pause() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.State != "playing" && s.State != "recording" {
+		return false
+	}
+	s.State = "ready"
+	return true
+}
+
+// resume 进入 playing 状态，返回 RTP-Info 的 seq 和第一个发出的包的 rtptime。
+// 第一次 PLAY 且有 GOP 缓存时先发送缓存的一段，不再等待关键帧。
+// 缓存里的帧时间戳压缩到最后一帧之前，每帧相差 1，播放器会立即解码显示到最新一帧，
+// 之后的直播包时间戳不需要改动。
+// 没有缓存时从之后推送的包开始发，视频要等到下一个关键帧，这时还不知道 rtptime，ok 为 false
+func (s *StreamSession) resume(burst []cachedPacket) (seq uint16, rtptime uint32, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.State = "playing"
+	seq = s.Sequence
+	if s.played || len(burst) == 0 {
+		s.played = true
+		// 组播成员不经过 SendRTPPacket，音频没有关键帧
+		s.waitKeyframe = s.multicast == nil && (s.Media == nil || s.Media.Type != "audio")
+		s.startWriter()
+		return seq, 0, false
+	}
+	s.played = true
+	s.waitKeyframe = false
+
+	// 统计缓存里有多少个不同的时间戳(帧)
+	frames := 0
+	for i, packet := range burst {
+		if i == 0 || packet.timestamp != burst[i-1].timestamp {
+			frames++
+		}
+	}
+	lastTS := burst[len(burst)-1].timestamp
+	newTS := lastTS - uint32(frames-1)
+	rtptime = newTS
+
+	s.burst = make([]outboundPacket, 0, len(burst))
+	for i, cached := range burst {
+		if i > 0 && cached.timestamp != burst[i-1].timestamp {
+			newTS++
+		}
+		packet := make([]byte, len(cached.data))
+		copy(packet, cached.data)
+		binary.BigEndian.PutUint16(packet[2:4], s.Sequence)
+		binary.BigEndian.PutUint32(packet[4:8], newTS)
+		s.Sequence++
+		s.recordSent(packet)
+		s.burst = append(s.burst, outboundPacket{data: packet})
+	}
+	s.trackTimestamp(s.burst[len(s.burst)-1].data)
+	s.startWriter()
+	return seq, rtptime, true
+}
+
 func (s *StreamSession) SendRTPPacket(data []byte, timestamp uint32, marker bool) error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	if s.State != "playing" {
 		return fmt.Errorf("session not in playing state")
 	}
+	if len(data) < 12 {
+		return fmt.Errorf("invalid rtp packet")
+	}
 
-	if s.isTcp && s.RTSPConn != nil {
-		interleavedData := s.buildInterleavedPacket(data, s.RTCPChannel)
-		_, err := s.RTSPConn.Write(interleavedData)
-		return err
-	} else if s.RTPSender != nil && s.ClientAddr != nil {
-		return s.RTPSender.SendRawData(data, s.ClientAddr)
+	if s.waitKeyframe {
+		if !keyframeStart(s.Media, data[12:]) {
+			return nil
+		}
+		s.waitKeyframe = false
+	}
+
+	// 打包器的序号是整个流共用的，暂停/跳帧后需要按 session 重新编号，
+	// 否则客户端会把跳过的部分当作丢包
+	packet := make([]byte, len(data))
+	copy(packet, data)
+	binary.BigEndian.PutUint16(packet[2:4], s.Sequence)
+	s.Sequence++
+	s.trackTimestamp(packet)
+	s.recordSent(packet)
+
+	s.enqueue(outboundPacket{data: packet})
+	if s.fec != nil {
+		if fec := s.fec.Add(packet); fec != nil {
+			s.enqueue(outboundPacket{data: fec, repair: true})
+		}
 	}
+	return nil
+}
+
+// trackTimestamp 记录 RTP 时间戳第一次出现时的墙上时间，调用者持有 s.mu
+func (s *StreamSession) trackTimestamp(packet []byte) {
+	timestamp := binary.BigEndian.Uint32(packet[4:8])
+	s.ssrc = binary.BigEndian.Uint32(packet[8:12])
+	if s.lastRTPWall.IsZero() || timestamp != s.lastRTPTimestamp {
+		s.lastRTPTimestamp = timestamp
+		s.lastRTPWall = time.Now()
+	}
+}
+
+// SendSenderReport 发送一个 RTCP SR，还没有发出过 RTP 包时不发送
+func (s *StreamSession) SendSenderReport(cname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.State != "playing" || s.lastRTPWall.IsZero() || s.sentPackets.Load() == 0 {
+		return
+	}
+
+	clockRate := 90000
+	if s.Media != nil && s.Media.ClockRate > 0 {
+		clockRate = s.Media.ClockRate
+	}
+	// 把最近的 RTP 时间戳按时钟频率推算到现在
+	now := time.Now()
+	elapsed := now.Sub(s.lastRTPWall)
+	rtpTimestamp := s.lastRTPTimestamp + uint32(elapsed*time.Duration(clockRate)/time.Second)
+
+	report := rtp.BuildSenderReport(rtp.SenderReport{
+		SSRC:         s.ssrc,
+		NTPTime:      now,
+		RTPTimestamp: rtpTimestamp,
+		PacketCount:  s.sentPackets.Load(),
+		OctetCount:   s.sentOctets.Load(),
+	}, cname)
+	s.enqueue(outboundPacket{data: report, rtcp: true})
+}
+
+func (s *StreamSession) multicastGroup() *multicastGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.multicast
+}
+
+// waitingKeyframe PLAY 之后是否还在等待关键帧
+func (s *StreamSession) waitingKeyframe() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.waitKeyframe
+}
 
-	return fmt.Errorf("no valid transport for sending RTP")
+// SetInterleavedChannels 使用客户端在 Transport 里指定的 interleaved 通道
+func (s *StreamSession) SetInterleavedChannels(rtpChannel, rtcpChannel int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RTPChannel = rtpChannel
+	s.RTCPChannel = rtcpChannel
 }
 
-func (s *StreamSession) buildInterleavedPacket(rtpData []byte, channel int) []byte {
+// StartIngest 推流 session 开始读取 UDP RTP 端口，收到的包交给 onPacket，socket 关闭后退出。
+// 只接受 SETUP 时客户端声明的地址和 RTP 端口发来的包，重复调用不会再启动一个读取
+func (s *StreamSession) StartIngest(onPacket func(packet []byte)) {
+	s.mu.Lock()
+	server := s.UDPServerRTP
+	if server == nil || s.ingesting {
+		s.mu.Unlock()
+		return
+	}
+	s.ingesting = true
+	s.mu.Unlock()
+
+	go func() {
+		buffer := make([]byte, 65536)
+		for {
+			n, addr, err := server.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if !s.fromClient(addr, false) {
+				utils.Debug("Publisher %s rtp from unexpected address %s dropped", s.SessionID, addr)
+				continue
+			}
+			packet := make([]byte, n)
+			copy(packet, buffer[:n])
+			onPacket(packet)
+		}
+	}()
+}
+
+func buildInterleavedFrame(rtpData []byte, channel int) []byte {
 	packet := make([]byte, len(rtpData)+4)
 	packet[0] = '$'
 	packet[1] = byte(channel)
@@ -143,10 +376,112 @@ func (s *StreamSession) buildInterleavedPacket(rtpData []byte, channel int) []by
 	return packet
 }
 
+// readRTCP 读取客户端发来的 RTCP，只接受 SETUP 时客户端声明的地址和 RTCP 端口发来的包，socket 关闭后退出
+func (s *StreamSession) readRTCP(server *transport.UDPServer) {
+	buffer := make([]byte, 1500)
+	for {
+		n, addr, err := server.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		if !s.fromClient(addr, true) {
+			utils.Debug("Session %s rtcp from unexpected address %s dropped", s.SessionID, addr)
+			continue
+		}
+		s.HandleRTCP(buffer[:n])
+	}
+}
+
+// fromClient 包是否来自 SETUP 时客户端声明的地址，rtcp 为 true 时比较 RTCP 端口，否则比较 RTP 端口。
+// 客户端没有声明端口时只比较地址
+func (s *StreamSession) fromClient(addr *net.UDPAddr, rtcp bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ClientAddr == nil || !s.ClientAddr.IP.Equal(addr.IP) {
+		return false
+	}
+	port := s.ClientRTPPort
+	if rtcp {
+		port = s.ClientRTCPort
+	}
+	return port == 0 || port == addr.Port
+}
+
+// setState 修改 session 状态
+func (s *StreamSession) setState(state string) {
+	s.mu.Lock()
+	s.State = state
+	s.mu.Unlock()
+}
+
+// recording 推流 session 是否已经 RECORD
+func (s *StreamSession) recording() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.State == "recording"
+}
+
+// pushState 推流时查看 session 是否在播放，需要断开时返回要关闭的连接
+func (s *StreamSession) pushState() (playing bool, closeConn net.Conn) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.NeedClose {
+		closeConn = s.RTSPConn
+	}
+	return s.State == "playing", closeConn
+}
+
+// configure SETUP 成功，记录 RTSP 连接和 control URL，进入 ready
+func (s *StreamSession) configure(conn net.Conn, controlURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.State = "ready"
+	s.RTSPConn = conn
+	s.ControlURL = controlURL
+	s.configured = true
+}
+
+// attach 其他轨道 SETUP 时记录第 0 个轨道的连接，ready 为 true 时还没有 SETUP 的第 0 个轨道进入 ready
+func (s *StreamSession) attach(conn net.Conn, ready bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RTSPConn = conn
+	if ready && s.State == "init" {
+		s.State = "ready"
+	}
+}
+
+// rtspConn 返回 session 所在的 RTSP 连接，还没有 SETUP 时为 nil
+func (s *StreamSession) rtspConn() net.Conn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RTSPConn
+}
+
+// markClose 标记需要断开，下一次推流时关闭连接
+func (s *StreamSession) markClose() {
+	s.mu.Lock()
+	s.NeedClose = true
+	s.mu.Unlock()
+}
+
+func (s *StreamSession) IdleTime() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Since(s.LastActive)
+}
+
 func (s *StreamSession) UpdateActivity() {
 	s.mu.Lock()
 	s.LastActive = time.Now()
 	s.mu.Unlock()
+	// 其他轨道的活动算在第 0 个轨道上，超时回收只看它
+	if s.parent != nil {
+		s.parent.UpdateActivity()
+	}
 }
 
 func (s *StreamSession) Close() {
@@ -162,24 +497,57 @@ func (s *StreamSession) Close() {
 	if s.RTPSender != nil {
 		s.RTPSender.Close()
 	}
+	s.stopWriter()
+	for _, track := range s.tracks {
+		track.Close()
+	}
 
 	s.State = "closed"
 	utils.Info("Session closed")
 }
 
-func (s *StreamSession) GetSDP() string {
-	// Generate SDP for H.264 video
-	sdp := fmt.Sprintf(`v=0
-o=- 0 0 IN IP4 0.0.0.0
-s=H265 Video Stream
-c=IN IP4 0.0.0.0
-t=0 0
-m=video %d RTP/AVP 96
-a=rtpmap:96 H265/90000
-a=control:streamid=%s
-`, s.ServerRTPPort, s.SessionID)
+// GetSDP 生成 DESCRIBE 的 SDP，localIP 是客户端连进来的本机地址，用于 o=/c= 行。
+// 每个轨道一个 m= 段，多轨道时 control 为 streamid=<session>/trackID=N
+func (s *StreamSession) GetSDP(localIP string) string {
+	medias := s.trackMedia
+	if len(medias) == 0 {
+		media := s.Media
+		if media == nil {
+			media = NewH265Media()
+		}
+		medias = []*MediaDescription{media}
+	}
+
+	addrType := "IP4"
+	if ip := net.ParseIP(localIP); ip != nil && ip.To4() == nil {
+		addrType = "IP6"
+	}
+
+	var b strings.Builder
+	b.WriteString("v=0\r\n")
+	fmt.Fprintf(&b, "o=- %d 1 IN %s %s\r\n", s.LastActive.Unix(), addrType, localIP)
+	// 会话名用流路径，和轨道的类型、编码无关
+	name := s.StreamPath
+	if name == "" {
+		name = "-"
+	}
+	fmt.Fprintf(&b, "s=%s\r\n", name)
+	fmt.Fprintf(&b, "c=IN %s %s\r\n", addrType, localIP)
+	b.WriteString("t=0 0\r\n")
+	if len(medias) > 1 {
+		// 聚合控制，PLAY/PAUSE 作用于所有轨道
+		b.WriteString("a=control:*\r\n")
+	}
+	for i, media := range medias {
+		// 其他轨道的端口在 SETUP 时分配
+		port := 0
+		if i == 0 {
+			port = s.ServerRTPPort
+		}
+		media.WriteSDP(&b, port, trackControl(s.SessionID, i, len(medias)))
+	}
 
-	return sdp
+	return b.String()
 }
 
 func (s *RTSPServer) GetOldestSessionByPath(streamPath string) (*StreamSession, bool) {
@@ -0,0 +1,93 @@
+package rtsp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tthhr/go_rtsp/net/transport"
+)
+
+func TestStreamSessionFromClient(t *testing.T) {
+	client := net.ParseIP("192.0.2.10")
+	tests := []struct {
+		name     string
+		rtpPort  int
+		rtcpPort int
+		addr     *net.UDPAddr
+		rtcp     bool
+		want     bool
+	}{
+		{name: "rtp from client port", rtpPort: 5000, rtcpPort: 5001, addr: &net.UDPAddr{IP: client, Port: 5000}, want: true},
+		{name: "rtcp from client port", rtpPort: 5000, rtcpPort: 5001, addr: &net.UDPAddr{IP: client, Port: 5001}, rtcp: true, want: true},
+		{name: "rtp from rtcp port", rtpPort: 5000, rtcpPort: 5001, addr: &net.UDPAddr{IP: client, Port: 5001}, want: false},
+		{name: "rtp from other port", rtpPort: 5000, rtcpPort: 5001, addr: &net.UDPAddr{IP: client, Port: 6000}, want: false},
+		{name: "other address", rtpPort: 5000, rtcpPort: 5001, addr: &net.UDPAddr{IP: net.ParseIP("192.0.2.11"), Port: 5000}, want: false},
+		{name: "no port declared", addr: &net.UDPAddr{IP: client, Port: 6000}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := NewStreamSession("live")
+			session.ClientAddr = &net.UDPAddr{IP: client}
+			session.ClientRTPPort = tt.rtpPort
+			session.ClientRTCPort = tt.rtcpPort
+			if got := session.fromClient(tt.addr, tt.rtcp); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 推流端 UDP 只接受 SETUP 声明的地址和端口，重复 RECORD 不会多启动一个读取
+func TestStreamSessionStartIngest(t *testing.T) {
+	server, err := transport.NewUDPServer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	publisher, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	spoofer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spoofer.Close()
+
+	session := NewStreamSession("live")
+	session.UDPServerRTP = server
+	session.ClientAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	session.ClientRTPPort = publisher.LocalAddr().(*net.UDPAddr).Port
+
+	received := make(chan string, 10)
+	for i := 0; i < 2; i++ {
+		session.StartIngest(func(packet []byte) {
+			received <- string(packet)
+		})
+	}
+
+	target := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: server.LocalPort()}
+	spoofer.WriteToUDP([]byte("spoofed"), target)
+	publisher.WriteToUDP([]byte("first"), target)
+	publisher.WriteToUDP([]byte("second"), target)
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("unexpected packet %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,112 @@
+package rtsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// trackControl SDP 中轨道的 control，单轨道时保持 streamid=<session>
+func trackControl(sessionID string, track, tracks int) string {
+	if tracks <= 1 {
+		return "streamid=" + sessionID
+	}
+	return fmt.Sprintf("streamid=%s/trackID=%d", sessionID, track)
+}
+
+// trackFromURL 取出 SETUP URL 中的 trackID，没有时为 0
+func trackFromURL(url string) int {
+	idx := strings.LastIndex(url, "trackID=")
+	if idx == -1 {
+		return 0
+	}
+	track, err := strconv.Atoi(strings.TrimSuffix(url[idx+len("trackID="):], "/"))
+	if err != nil || track < 0 {
+		return 0
+	}
+	return track
+}
+
+// mediaTrack 按推流端 SDP 里的 a=control 找到 SETUP URL 对应的轨道
+func mediaTrack(medias []*MediaDescription, url string) int {
+	for i, media := range medias {
+		if media.Control == "" {
+			continue
+		}
+		if url == media.Control || strings.HasSuffix(url, "/"+media.Control) {
+			return i
+		}
+	}
+	return trackFromURL(url)
+}
+
+// trackSession 返回 session 上某个轨道的 session，第 0 个轨道是 session 自己，
+// 其他轨道第一次 SETUP 时创建，和 session 共用 SessionID，各自有传输、序号和发送队列
+func (s *RTSPServer) trackSession(owner *StreamSession, track int) *StreamSession {
+	if track == 0 {
+		return owner
+	}
+
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if child, ok := owner.tracks[track]; ok {
+		return child
+	}
+
+	child := s.newSession(owner.StreamPath)
+	child.SessionID = owner.SessionID
+	child.Track = track
+	child.parent = owner
+	child.publishing = owner.publishing
+	child.Media = owner.trackMedia[track]
+	if owner.tracks == nil {
+		owner.tracks = make(map[int]*StreamSession)
+	}
+	owner.tracks[track] = child
+	return child
+}
+
+// trackCount 流的轨道数
+func (s *StreamSession) trackCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.trackMedia) == 0 {
+		return 1
+	}
+	return len(s.trackMedia)
+}
+
+// trackSessions 返回已经 SETUP 的轨道
+func (s *StreamSession) trackSessions() []*StreamSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tracks []*StreamSession
+	if s.configured {
+		tracks = append(tracks, s)
+	}
+	for i := 1; i < len(s.trackMedia); i++ {
+		if child, ok := s.tracks[i]; ok {
+			tracks = append(tracks, child)
+		}
+	}
+	return tracks
+}
+
+// trackByChannel 找到 interleaved 通道所属的轨道
+func (s *StreamSession) trackByChannel(channel int) *StreamSession {
+	for _, track := range s.trackSessions() {
+		if track.RTPChannel == channel || track.RTCPChannel == channel {
+			return track
+		}
+	}
+	return nil
+}
+
+// root 返回轨道所属的 session(第 0 个轨道)
+func (s *StreamSession) root() *StreamSession {
+	if s.parent != nil {
+		return s.parent
+	}
+	return s
+}
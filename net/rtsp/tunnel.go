@@ -0,0 +1,242 @@
+package rtsp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tthhr/go_rtsp/utils"
+)
+
+// RTSP over HTTP (Apple x-rtsp-tunnelled):
+// 客户端先发 GET 建立下行通道，服务端的 RTSP 响应和 interleaved RTP 都写在 GET 的响应里；
+// 再用相同 x-sessioncookie 发 POST，body 是 base64 编码的 RTSP 请求
+
+const tunnelPairTimeout = 30 * time.Second
+
+// bufferedConn 把嗅探时已经读进 bufio.Reader 的数据还给后续的读取者
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// tunnelConn 把 GET/POST 两条连接组合成一个 net.Conn 交给 handleRTSPConnection
+type tunnelConn struct {
+	net.Conn // GET 连接，写数据和地址都用它
+	post     net.Conn
+	decoder  *tunnelDecoder
+	once     sync.Once
+}
+
+func (c *tunnelConn) Read(b []byte) (int, error) {
+	return c.decoder.Read(b)
+}
+
+func (c *tunnelConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.post.Close()
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+func (c *tunnelConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// tunnelDecoder 按 4 字符一组解码 base64，
+// 客户端每个请求单独编码并带 padding，逐组解码可以处理拼接在一起的多个请求
+type tunnelDecoder struct {
+	reader  *bufio.Reader
+	quantum [4]byte
+	filled  int
+	pending []byte
+}
+
+func (d *tunnelDecoder) Read(b []byte) (int, error) {
+	for len(d.pending) == 0 {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c == '\r' || c == '\n' || c == ' ' || c == '\t' {
+			continue
+		}
+		d.quantum[d.filled] = c
+		d.filled++
+		if d.filled < 4 {
+			continue
+		}
+		d.filled = 0
+
+		decoded := make([]byte, 3)
+		n, err := base64.StdEncoding.Decode(decoded, d.quantum[:])
+		if err != nil {
+			return 0, fmt.Errorf("tunnel base64 decode: %v", err)
+		}
+		d.pending = decoded[:n]
+	}
+
+	n := copy(b, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// pendingTunnel 已经收到 GET、等待 POST 的隧道
+type pendingTunnel struct {
+	conn  net.Conn
+	timer *time.Timer
+}
+
+// handleConnection 嗅探第一行，HTTP 的 GET/POST 走隧道，其余按 RTSP 处理
+func (s *RTSPServer) handleConnection(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	buffered := &bufferedConn{Conn: conn, reader: reader}
+
+	if s.httpTunnelEnable {
+		conn.SetReadDeadline(time.Now().Add(tunnelPairTimeout))
+		firstLine, err := reader.Peek(5)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			return
+		}
+		method := string(firstLine)
+		if strings.HasPrefix(method, "GET ") || strings.HasPrefix(method, "POST ") {
+			s.handleHTTPTunnel(buffered, reader)
+			return
+		}
+	}
+
+	s.handleRTSPConnection(buffered)
+}
+
+func (s *RTSPServer) handleHTTPTunnel(conn net.Conn, reader *bufio.Reader) {
+	method, headers, err := readHTTPRequest(reader)
+	if err != nil {
+		utils.Error("HTTP tunnel read error: %s", err.Error())
+		conn.Close()
+		return
+	}
+	if s.protocolLog {
+		utils.Debug("HTTP tunnel %s from %s, headers %v", method, conn.RemoteAddr().String(), headers)
+	}
+
+	cookie := headers["x-sessioncookie"]
+	if cookie == "" {
+		conn.Write([]byte("HTTP/1.0 400 Bad Request\r\nConnection: close\r\n\r\n"))
+		conn.Close()
+		return
+	}
+
+	switch method {
+	case "GET":
+		response := "HTTP/1.0 200 OK\r\n" +
+			"Server: " + s.serverName + "\r\n" +
+			"Connection: close\r\n" +
+			"Cache-Control: no-store\r\n" +
+			"Pragma: no-cache\r\n" +
+			"Content-Type: application/x-rtsp-tunnelled\r\n\r\n"
+		if _, err := conn.Write([]byte(response)); err != nil {
+			conn.Close()
+			return
+		}
+
+		s.tunnelMu.Lock()
+		if old, exists := s.tunnels[cookie]; exists {
+			old.timer.Stop()
+			old.conn.Close()
+		}
+		s.tunnels[cookie] = &pendingTunnel{
+			conn: conn,
+			timer: time.AfterFunc(tunnelPairTimeout, func() {
+				if s.takeTunnel(cookie) != nil {
+					utils.Warn("HTTP tunnel %s: no POST received", cookie)
+					conn.Close()
+				}
+			}),
+		}
+		s.tunnelMu.Unlock()
+
+	case "POST":
+		getConn := s.takeTunnel(cookie)
+		if getConn == nil {
+			utils.Warn("HTTP tunnel %s: POST without GET", cookie)
+			conn.Write([]byte("HTTP/1.0 404 Not Found\r\nConnection: close\r\n\r\n"))
+			conn.Close()
+			return
+		}
+
+		tunnel := &tunnelConn{
+			Conn:    getConn,
+			post:    conn,
+			decoder: &tunnelDecoder{reader: reader},
+		}
+		// 客户端关闭 GET 通道时结束整个隧道
+		go func() {
+			io.Copy(io.Discard, getConn)
+			tunnel.Close()
+		}()
+		utils.Info("HTTP tunnel %s established", cookie)
+		s.handleRTSPConnection(tunnel)
+
+	default:
+		conn.Write([]byte("HTTP/1.0 405 Method Not Allowed\r\nConnection: close\r\n\r\n"))
+		conn.Close()
+	}
+}
+
+func (s *RTSPServer) takeTunnel(cookie string) net.Conn {
+	s.tunnelMu.Lock()
+	defer s.tunnelMu.Unlock()
+
+	pending, ok := s.tunnels[cookie]
+	if !ok {
+		return nil
+	}
+	pending.timer.Stop()
+	delete(s.tunnels, cookie)
+	return pending.conn
+}
+
+// readHTTPRequest 读取 HTTP 请求行和头，头名统一转为小写
+func readHTTPRequest(reader *bufio.Reader) (string, map[string]string, error) {
+	requestLine, err := reader.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+	parts := strings.Fields(requestLine)
+	if len(parts) < 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return "", nil, fmt.Errorf("invalid http request line: %q", requestLine)
+	}
+
+	headers := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if idx := strings.Index(line, ":"); idx > 0 {
+			headers[strings.ToLower(strings.TrimSpace(line[:idx]))] = strings.TrimSpace(line[idx+1:])
+		}
+	}
+	return parts[0], headers, nil
+}
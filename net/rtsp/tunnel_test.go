@@ -0,0 +1,176 @@
+package rtsp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTunnelDecoder(t *testing.T) {
+	options := "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\n\r\n"
+	describe := "DESCRIBE rtsp://host/live RTSP/1.0\r\nCSeq: 2\r\n\r\n"
+	encode := base64.StdEncoding.EncodeToString
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "single request",
+			input: encode([]byte(options)),
+			want:  options,
+		},
+		{
+			name:  "concatenated padded requests",
+			input: encode([]byte("A")) + encode([]byte("BC")) + encode([]byte(options)),
+			want:  "ABC" + options,
+		},
+		{
+			name:  "line breaks between quanta",
+			input: encode([]byte(options)) + "\r\n" + encode([]byte(describe)) + "\n",
+			want:  options + describe,
+		},
+		{
+			name:  "whitespace inside quantum",
+			input: "QU\r\nJD",
+			want:  "ABC",
+		},
+		{
+			name:  "empty",
+			input: "",
+			want:  "",
+		},
+		{
+			name:  "incomplete quantum dropped",
+			input: encode([]byte("ABC")) + "QU",
+			want:  "ABC",
+		},
+		{
+			name:    "invalid character",
+			input:   "QU*D",
+			wantErr: true,
+		},
+		{
+			name:    "padding in the middle",
+			input:   "Q=JD",
+			wantErr: true,
+		},
+		{
+			name:    "url alphabet",
+			input:   "-_-_",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := &tunnelDecoder{reader: bufio.NewReader(strings.NewReader(tt.input))}
+			got, err := io.ReadAll(decoder)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 解码结果按 1 字节读取也不丢数据，RTSPReader 可以直接读出请求
+func TestTunnelDecoderRTSPReader(t *testing.T) {
+	input := base64.StdEncoding.EncodeToString([]byte("OPTIONS * RTSP/1.0\r\nCSeq: 1\r\n\r\n")) +
+		base64.StdEncoding.EncodeToString([]byte("PLAY rtsp://host/live RTSP/1.0\r\nCSeq: 2\r\n\r\n"))
+
+	decoder := &tunnelDecoder{reader: bufio.NewReader(strings.NewReader(input))}
+	var out []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := decoder.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := NewRTSPReader(strings.NewReader(string(out)))
+	for _, method := range []string{MethodOptions, MethodPlay} {
+		req, _, err := reader.ReadMessage()
+		if err != nil || req.Method != method {
+			t.Fatalf("got %+v %v, want %s", req, err, method)
+		}
+	}
+}
+
+func TestReadHTTPRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		method  string
+		cookie  string
+		wantErr bool
+	}{
+		{
+			name:   "get",
+			input:  "GET /live HTTP/1.0\r\nx-sessioncookie: abc\r\nAccept: application/x-rtsp-tunnelled\r\n\r\n",
+			method: "GET",
+			cookie: "abc",
+		},
+		{
+			name:   "header name case",
+			input:  "POST /live HTTP/1.1\r\nX-SessionCookie:  xyz \r\n\r\n",
+			method: "POST",
+			cookie: "xyz",
+		},
+		{
+			name:    "rtsp request line",
+			input:   "OPTIONS * RTSP/1.0\r\n\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "short request line",
+			input:   "GET\r\n\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "truncated headers",
+			input:   "GET /live HTTP/1.0\r\nx-sessioncookie: abc\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, headers, err := readHTTPRequest(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s %v", method, headers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if method != tt.method || headers["x-sessioncookie"] != tt.cookie {
+				t.Fatalf("got %s cookie=%q, want %s cookie=%q", method, headers["x-sessioncookie"], tt.method, tt.cookie)
+			}
+		})
+	}
+}
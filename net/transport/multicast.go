@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"net"
+)
+
+// NewMulticastSender 创建发送组播的 UDP socket，本地端口随机，ttl 为组播包的跳数
+func NewMulticastSender(ttl int) (*UDPServer, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	conn.SetWriteBuffer(4 * 1024 * 1024)
+
+	if ttl > 0 {
+		if err := setMulticastTTL(conn, ttl); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &UDPServer{conn: conn}, nil
+}
+
+// NewMulticastReceiver 加入组播组并监听端口，用于接收组内成员发来的 RTCP
+func NewMulticastReceiver(group net.IP, port int) (*UDPServer, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{IP: group, Port: port})
+	if err != nil {
+		return nil, err
+	}
+	return &UDPServer{conn: conn}, nil
+}
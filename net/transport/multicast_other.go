@@ -0,0 +1,12 @@
+//go:build !unix
+
+package transport
+
+import (
+	"net"
+)
+
+// 其他平台不设置，使用系统默认的组播 TTL(一般为 1)
+func setMulticastTTL(conn *net.UDPConn, ttl int) error {
+	return nil
+}
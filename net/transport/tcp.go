@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"crypto/tls"
+	"errors"
 	"net"
 	"time"
 )
@@ -21,10 +23,41 @@ func NewTCPServer(addr string) (*TCPServer, error) {
 	}, nil
 }
 
+// NewTLSServer 创建 TLS 监听，accept 得到的连接是 *tls.Conn
+func NewTLSServer(addr string, config *tls.Config) (*TCPServer, error) {
+	listener, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TCPServer{
+		listener: listener,
+	}, nil
+}
+
+// IsTLSConn 判断连接是否来自 TLS 监听，包装过的连接通过 NetConn 取底层连接
+func IsTLSConn(conn net.Conn) bool {
+	for conn != nil {
+		if _, ok := conn.(*tls.Conn); ok {
+			return true
+		}
+		wrapped, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return false
+		}
+		conn = wrapped.NetConn()
+	}
+	return false
+}
+
 func (s *TCPServer) Start() {
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
+			// Stop 之后退出，其他错误(如 fd 不够)继续接受
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			continue
 		}
 
@@ -20,7 +20,7 @@ func ParseTransport(transport string) (string, bool, int, int, int, int, string,
 	params := make(map[string]string)
 	parts := strings.Split(transport, ";")
 	tcpMode := false
-	if strings.Contains(transport, "RTP/AVP/TCP") {
+	if strings.Contains(transport, "RTP/AVP/TCP") || strings.Contains(transport, "RTP/AVPF/TCP") {
 		tcpMode = true
 	}
 	// 解析模式和参数
@@ -83,3 +83,26 @@ func GetLocalIP() string {
 	}
 	return "127.0.0.1"
 }
+
+// ParseInterleaved 解析 Transport 里的 interleaved=a-b，没有时返回 false
+func ParseInterleaved(transport string) (int, int, bool) {
+	for _, part := range strings.Split(transport, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 || kv[0] != "interleaved" {
+			continue
+		}
+		channels := strings.Split(kv[1], "-")
+		rtpChannel, err := strconv.Atoi(channels[0])
+		if err != nil {
+			return 0, 0, false
+		}
+		rtcpChannel := rtpChannel + 1
+		if len(channels) > 1 {
+			if c, err := strconv.Atoi(channels[1]); err == nil {
+				rtcpChannel = c
+			}
+		}
+		return rtpChannel, rtcpChannel, true
+	}
+	return 0, 0, false
+}
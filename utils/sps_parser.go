@@ -0,0 +1,397 @@
+package utils
+
+import (
+	"errors"
+)
+
+// H265SPSInfo 从 H.265 SPS 中解析出的信息，生成 SDP 用
+type H265SPSInfo struct {
+	ProfileSpace uint8
+	TierFlag     uint8
+	ProfileID    uint8
+	LevelID      uint8
+	Width        int
+	Height       int
+}
+
+// H264SPSInfo 从 H.264 SPS 中解析出的信息，生成 SDP 用
+type H264SPSInfo struct {
+	ProfileIDC uint8
+	Constraint uint8
+	LevelIDC   uint8
+	Width      int
+	Height     int
+}
+
+var (
+	errSPSTruncated = errors.New("sps truncated")
+	errSPSCropping  = errors.New("sps cropping exceeds picture size")
+)
+
+// bitReader 按位读取去掉防竞争字节之后的 RBSP
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) readBit() (uint32, error) {
+	if r.pos >= len(r.data)*8 {
+		return 0, errSPSTruncated
+	}
+	bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+	r.pos++
+	return uint32(bit), nil
+}
+
+func (r *bitReader) readBits(n int) (uint32, error) {
+	var value uint32
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | bit
+	}
+	return value, nil
+}
+
+func (r *bitReader) skipBits(n int) error {
+	if r.pos+n > len(r.data)*8 {
+		return errSPSTruncated
+	}
+	r.pos += n
+	return nil
+}
+
+// readUE 无符号指数哥伦布码
+func (r *bitReader) readUE() (uint32, error) {
+	leadingZeros := 0
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		leadingZeros++
+		if leadingZeros > 31 {
+			return 0, errors.New("invalid exp-golomb code")
+		}
+	}
+	suffix, err := r.readBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<leadingZeros - 1) + suffix, nil
+}
+
+// readSE 有符号指数哥伦布码
+func (r *bitReader) readSE() (int32, error) {
+	value, err := r.readUE()
+	if err != nil {
+		return 0, err
+	}
+	if value&1 == 1 {
+		return int32((value + 1) / 2), nil
+	}
+	return -int32(value / 2), nil
+}
+
+// RemoveEmulationPrevention 去掉 NALU 中的 00 00 03 防竞争字节
+func RemoveEmulationPrevention(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// ParseH265SPS 解析 H.265 SPS(包含 2 字节 NALU 头)中的 profile/tier/level 和分辨率
+func ParseH265SPS(sps []byte) (*H265SPSInfo, error) {
+	if len(sps) < 3 {
+		return nil, errSPSTruncated
+	}
+	r := &bitReader{data: RemoveEmulationPrevention(sps[2:])}
+	info := &H265SPSInfo{}
+
+	// sps_video_parameter_set_id(4) + sps_max_sub_layers_minus1(3) + sps_temporal_id_nesting_flag(1)
+	if err := r.skipBits(4); err != nil {
+		return nil, err
+	}
+	maxSubLayersMinus1, err := r.readBits(3)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.skipBits(1); err != nil {
+		return nil, err
+	}
+
+	// profile_tier_level
+	profileSpace, _ := r.readBits(2)
+	tierFlag, _ := r.readBits(1)
+	profileIDC, _ := r.readBits(5)
+	// general_profile_compatibility_flag[32] + 48 位约束标志
+	if err := r.skipBits(32 + 48); err != nil {
+		return nil, err
+	}
+	levelIDC, err := r.readBits(8)
+	if err != nil {
+		return nil, err
+	}
+	info.ProfileSpace = uint8(profileSpace)
+	info.TierFlag = uint8(tierFlag)
+	info.ProfileID = uint8(profileIDC)
+	info.LevelID = uint8(levelIDC)
+
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		p, _ := r.readBits(1)
+		l, err := r.readBits(1)
+		if err != nil {
+			return nil, err
+		}
+		profilePresent[i] = p == 1
+		levelPresent[i] = l == 1
+	}
+	if maxSubLayersMinus1 > 0 {
+		for i := maxSubLayersMinus1; i < 8; i++ {
+			if err := r.skipBits(2); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		if profilePresent[i] {
+			if err := r.skipBits(88); err != nil {
+				return nil, err
+			}
+		}
+		if levelPresent[i] {
+			if err := r.skipBits(8); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// sps_seq_parameter_set_id
+	if _, err := r.readUE(); err != nil {
+		return nil, err
+	}
+	chromaFormatIDC, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	if chromaFormatIDC == 3 {
+		if err := r.skipBits(1); err != nil {
+			return nil, err
+		}
+	}
+	width, _ := r.readUE()
+	height, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+
+	conformanceWindow, err := r.readBits(1)
+	if err != nil {
+		return nil, err
+	}
+	if conformanceWindow == 1 {
+		left, _ := r.readUE()
+		right, _ := r.readUE()
+		top, _ := r.readUE()
+		bottom, err := r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		subWidth, subHeight := chromaSubsampling(chromaFormatIDC)
+		if width, err = cropSize(width, subWidth, left, right); err != nil {
+			return nil, err
+		}
+		if height, err = cropSize(height, subHeight, top, bottom); err != nil {
+			return nil, err
+		}
+	}
+	info.Width = int(width)
+	info.Height = int(height)
+	return info, nil
+}
+
+// ParseH264SPS 解析 H.264 SPS(包含 1 字节 NALU 头)中的 profile/level 和分辨率
+func ParseH264SPS(sps []byte) (*H264SPSInfo, error) {
+	if len(sps) < 4 {
+		return nil, errSPSTruncated
+	}
+	info := &H264SPSInfo{
+		ProfileIDC: sps[1],
+		Constraint: sps[2],
+		LevelIDC:   sps[3],
+	}
+	r := &bitReader{data: RemoveEmulationPrevention(sps[4:])}
+
+	// seq_parameter_set_id
+	if _, err := r.readUE(); err != nil {
+		return nil, err
+	}
+
+	chromaFormatIDC := uint32(1)
+	switch info.ProfileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		var err error
+		chromaFormatIDC, err = r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		if chromaFormatIDC == 3 {
+			r.skipBits(1)
+		}
+		r.readUE() // bit_depth_luma_minus8
+		r.readUE() // bit_depth_chroma_minus8
+		r.skipBits(1)
+		scalingMatrix, err := r.readBits(1)
+		if err != nil {
+			return nil, err
+		}
+		if scalingMatrix == 1 {
+			count := 8
+			if chromaFormatIDC == 3 {
+				count = 12
+			}
+			for i := 0; i < count; i++ {
+				present, err := r.readBits(1)
+				if err != nil {
+					return nil, err
+				}
+				if present == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				if err := skipScalingList(r, size); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	r.readUE() // log2_max_frame_num_minus4
+	pocType, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	switch pocType {
+	case 0:
+		r.readUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.skipBits(1)
+		r.readSE()
+		r.readSE()
+		cycle, err := r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		// num_ref_frames_in_pic_order_cnt_cycle 范围是 0..255
+		if cycle > 255 {
+			return nil, errors.New("sps num_ref_frames_in_pic_order_cnt_cycle out of range")
+		}
+		for i := uint32(0); i < cycle; i++ {
+			r.readSE()
+		}
+	}
+	r.readUE()    // max_num_ref_frames
+	r.skipBits(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthInMbsMinus1, _ := r.readUE()
+	heightInMapUnitsMinus1, _ := r.readUE()
+	frameMbsOnly, err := r.readBits(1)
+	if err != nil {
+		return nil, err
+	}
+	if frameMbsOnly == 0 {
+		r.skipBits(1)
+	}
+	r.skipBits(1) // direct_8x8_inference_flag
+
+	width := (widthInMbsMinus1 + 1) * 16
+	height := (2 - frameMbsOnly) * (heightInMapUnitsMinus1 + 1) * 16
+
+	cropping, err := r.readBits(1)
+	if err != nil {
+		return nil, err
+	}
+	if cropping == 1 {
+		left, _ := r.readUE()
+		right, _ := r.readUE()
+		top, _ := r.readUE()
+		bottom, err := r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		cropX, cropY := chromaSubsampling(chromaFormatIDC)
+		if chromaFormatIDC == 0 {
+			cropX, cropY = 1, 1
+		}
+		cropY *= 2 - frameMbsOnly
+		if width, err = cropSize(width, cropX, left, right); err != nil {
+			return nil, err
+		}
+		if height, err = cropSize(height, cropY, top, bottom); err != nil {
+			return nil, err
+		}
+	}
+
+	info.Width = int(width)
+	info.Height = int(height)
+	return info, nil
+}
+
+// cropSize 从 size 中减去两边的裁剪，裁剪不小于 size 时返回错误
+func cropSize(size, unit, before, after uint32) (uint32, error) {
+	crop := uint64(unit) * (uint64(before) + uint64(after))
+	if crop >= uint64(size) {
+		return 0, errSPSCropping
+	}
+	return size - uint32(crop), nil
+}
+
+func skipScalingList(r *bitReader, size int) error {
+	lastScale, nextScale := int32(8), int32(8)
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			delta, err := r.readSE()
+			if err != nil {
+				return err
+			}
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+	return nil
+}
+
+// chromaSubsampling 返回 SubWidthC/SubHeightC
+func chromaSubsampling(chromaFormatIDC uint32) (uint32, uint32) {
+	switch chromaFormatIDC {
+	case 1:
+		return 2, 2
+	case 2:
+		return 2, 1
+	}
+	return 1, 1
+}
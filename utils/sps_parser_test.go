@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func spsBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseH264SPS(t *testing.T) {
+	tests := []struct {
+		name    string
+		sps     string
+		want    *H264SPSInfo
+		wantErr error // 为 nil 且 want 为 nil 时只要求出错
+	}{
+		{
+			// x264 编码的 1080p，1088 行裁掉底部 8 行
+			name: "x264 high 1080p cropped",
+			sps:  "67 64 00 28 AC D9 40 78 02 27 E5 C0 44 00 00 03 00 04 00 00 03 00 C8 3C 60 C6 58",
+			want: &H264SPSInfo{ProfileIDC: 100, LevelIDC: 40, Width: 1920, Height: 1080},
+		},
+		{
+			name: "main 720p with vui",
+			sps:  "67 4D 40 1F E8 80 28 02 DD 80 B5 01 01 01 40 00 00 03 00 40 00 00 0C 83 C6 0C 44 80",
+			want: &H264SPSInfo{ProfileIDC: 77, Constraint: 0x40, LevelIDC: 31, Width: 1280, Height: 720},
+		},
+		{
+			name: "high 720p",
+			sps:  "67 64 00 1F AC D9 40 50 05 BB 01 10 00 00 03 00 10 00 00 03 03 C0 F1 83 19 60",
+			want: &H264SPSInfo{ProfileIDC: 100, LevelIDC: 31, Width: 1280, Height: 720},
+		},
+		{
+			// 按字段编码: seq_scaling_matrix_present_flag=1，4x4 第 0 个表逐项给出，
+			// 8x8 第 0 个表 delta=-8 使用默认表，第 1 个表 64 个 delta 都为 0，1080p 裁剪
+			name: "high 1080p with scaling matrix",
+			sps:  "67 64 00 28 AD A6 9A 69 A6 9A 69 82 11 FF FF FF FF FF FF FF FF EC A0 3C 01 13 F2 A0",
+			want: &H264SPSInfo{ProfileIDC: 100, LevelIDC: 40, Width: 1920, Height: 1080},
+		},
+		{
+			// 按字段编码: pic_order_cnt_type=1，一个周期 2 个参考帧，CIF
+			name: "baseline cif poc type 1",
+			sps:  "67 42 C0 15 D0 A9 90 88 16 09 64",
+			want: &H264SPSInfo{ProfileIDC: 66, Constraint: 0xC0, LevelIDC: 21, Width: 352, Height: 288},
+		},
+		{
+			// 按字段编码: frame_mbs_only_flag=0，34 个场 map unit，裁剪按 2 倍计算
+			name: "main 1080i",
+			sps:  "67 4D 40 28 EC A0 3C 02 23 ED",
+			want: &H264SPSInfo{ProfileIDC: 77, Constraint: 0x40, LevelIDC: 40, Width: 1920, Height: 1080},
+		},
+		{
+			name: "too short",
+			sps:  "67 64 00",
+		},
+		{
+			name:    "truncated",
+			sps:     "67 64 00 28 AC D9 40 78",
+			wantErr: errSPSTruncated,
+		},
+		{
+			name:    "truncated in scaling list",
+			sps:     "67 64 00 28 AD A6 9A 69 A6 9A",
+			wantErr: errSPSTruncated,
+		},
+		{
+			name: "poc cycle out of range",
+			sps:  "67 42 C0 1E D3 00 80 A4 92 49 40",
+		},
+		{
+			name:    "cropping whole width",
+			sps:     "67 42 C0 0A ED 3F 13 A0",
+			wantErr: errSPSCropping,
+		},
+		{
+			// bottom 裁剪接近 2^31，乘以 2 之后超出 uint32
+			name:    "cropping overflows",
+			sps:     "67 42 C0 28 ED 00 F0 04 4F C0 00 00 03 00 40 00 00 03 00 20",
+			wantErr: errSPSCropping,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseH264SPS(spsBytes(t, tt.sps))
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseH265SPS(t *testing.T) {
+	tests := []struct {
+		name    string
+		sps     string
+		want    *H265SPSInfo
+		wantErr error
+	}{
+		{
+			name: "main 720p",
+			sps:  "42 01 01 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5D A0 02 80 80 2D 16 59 59 A4 93 2B C0 5A 02 00 00 03 00 02 00 00 03 00 3C 10",
+			want: &H265SPSInfo{ProfileID: 1, LevelID: 93, Width: 1280, Height: 720},
+		},
+		{
+			// 1088 行，conformance window 裁掉底部 8 行
+			name: "main 1080p cropped",
+			sps:  "42 01 01 01 60 00 00 03 00 B0 00 00 03 00 00 03 00 7B A0 03 C0 80 10 E5 96 56 69 24 CA F0 16 9C 20 00 00 03 00 20 00 00 03 03 C1",
+			want: &H265SPSInfo{ProfileID: 1, LevelID: 123, Width: 1920, Height: 1080},
+		},
+		{
+			// 按字段编码: 两个时域子层，子层带 level
+			name: "sub layer level",
+			sps:  "42 01 03 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5D 40 00 5A A0 03 C0 80 11 07 CB C0",
+			want: &H265SPSInfo{ProfileID: 1, LevelID: 93, Width: 1920, Height: 1080},
+		},
+		{
+			// 按字段编码: 4:4:4 时裁剪单位是 1
+			name: "chroma 444 cropped",
+			sps:  "42 01 01 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5D 90 00 78 10 02 20 F8 9E",
+			want: &H265SPSInfo{ProfileID: 1, LevelID: 93, Width: 1920, Height: 1080},
+		},
+		{
+			name:    "too short",
+			sps:     "42 01",
+			wantErr: errSPSTruncated,
+		},
+		{
+			name:    "truncated in profile tier level",
+			sps:     "42 01 01 01 60 00 00 03 00 90",
+			wantErr: errSPSTruncated,
+		},
+		{
+			name:    "truncated in size",
+			sps:     "42 01 01 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5D A0 02",
+			wantErr: errSPSTruncated,
+		},
+		{
+			name:    "cropping whole height",
+			sps:     "42 01 01 01 60 00 00 03 00 90 00 00 03 00 00 03 00 5D A0 02 80 80 2D 1F 00 C8 F0",
+			wantErr: errSPSCropping,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseH265SPS(spsBytes(t, tt.sps))
+			if tt.want == nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v (got %+v)", err, tt.wantErr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "none", data: "01 02 03", want: "01 02 03"},
+		{name: "one", data: "00 00 03 01", want: "00 00 01"},
+		{name: "consecutive", data: "00 00 03 00 00 03 00", want: "00 00 00 00 00"},
+		{name: "trailing", data: "AA 00 00 03", want: "AA 00 00"},
+		{name: "single zero before 03 kept", data: "00 03 00", want: "00 03 00"},
+	}
+	for _, tt := range tests {
+		got := RemoveEmulationPrevention(spsBytes(t, tt.data))
+		if want := spsBytes(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got % X, want % X", tt.name, got, want)
+		}
+	}
+}